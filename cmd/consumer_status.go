@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var consumerStatusGroup string
+
+// consumerStatusCmd prints the lag of a consumer group from the offsets it
+// committed to kafka, it works whether or not the consumer is running.
+var consumerStatusCmd = &cobra.Command{
+	Use:   "consumer-status",
+	Short: "Print the lag of the activity consumer group",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topic := viper.GetString("kafka.topic")
+		group := consumerStatusGroup
+		if group == "" {
+			group = viper.GetString("kafka.consumer_group")
+		}
+
+		lags, err := events.KafkaGroupLag(topic, group)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Topic %s, consumer group %s\n", topic, group)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PARTITION\tCOMMITTED\tHIGH-WATER MARK\tLAG")
+		var total int64
+		for _, lag := range lags {
+			committed := fmt.Sprint(lag.Committed)
+			if lag.Committed < 0 {
+				committed = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\n", lag.Partition, committed, lag.HighWaterMark, lag.Lag)
+			total += lag.Lag
+		}
+		fmt.Fprintf(w, "TOTAL\t\t\t%d\n", total)
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	consumerStatusCmd.Flags().StringVar(&consumerStatusGroup, "group", "", "consumer group to report (default kafka.consumer_group)")
+
+	rootCmd.AddCommand(consumerStatusCmd)
+}
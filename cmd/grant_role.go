@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	grantRoleEmail string
+	grantRoleRole  string
+)
+
+// grantRoleCmd sets the role of a registered customer, it is the only way to
+// create the first admin.
+var grantRoleCmd = &cobra.Command{
+	Use:   "grant-role",
+	Short: "Set the role of a customer",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		role := strings.ToUpper(grantRoleRole)
+		if err := auth.ValidateRole(role); err != nil {
+			return fmt.Errorf("%w %q", err, grantRoleRole)
+		}
+
+		logger, _ := newLogger()
+		mysqlRepo := newMySQLRepo(logger)
+		defer closeRepo(logger, mysqlRepo)
+
+		email := strings.ToLower(grantRoleEmail)
+		err := mysqlRepo.SetCustomerRole(context.Background(), email, role)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("no customer is registered with %s", email)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Granted %s to %s\n", role, email)
+		return nil
+	},
+}
+
+func init() {
+	grantRoleCmd.Flags().StringVar(&grantRoleEmail, "email", "", "email of the customer")
+	grantRoleCmd.Flags().StringVar(&grantRoleRole, "role", "", "admin, merchandiser, support or customer")
+	grantRoleCmd.MarkFlagRequired("email")
+	grantRoleCmd.MarkFlagRequired("role")
+
+	rootCmd.AddCommand(grantRoleCmd)
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/consumers"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/repository"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	replayFromOffset    int64
+	replayFromTimestamp string
+	replayGroup         string
+	replayProjection    string
+	replayDryRun        bool
+	replayProgressEvery uint64
+)
+
+// replayCmd rebuilds a projection by re-consuming the activity topic with a
+// dedicated consumer group, so the running consumers are not affected.
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-consume the activity topic into a projection",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logger, _ := newLogger()
+
+		opts := events.ReplayOptions{
+			Topic:      viper.GetString("kafka.topic"),
+			Group:      replayGroup,
+			FromOffset: replayFromOffset,
+		}
+		if opts.Group == "" {
+			opts.Group = fmt.Sprintf("%s-replay-%d", viper.GetString("kafka.consumer_group"), time.Now().Unix())
+		}
+		if replayFromTimestamp != "" {
+			if cmd.Flags().Changed("from-offset") {
+				return errors.New("--from-offset and --from-timestamp are mutually exclusive")
+			}
+			fromTime, err := time.Parse(time.RFC3339, replayFromTimestamp)
+			if err != nil {
+				return fmt.Errorf("--from-timestamp must be RFC3339: %w", err)
+			}
+			opts.FromTime = fromTime
+		}
+
+		// a dry run only consumes the messages, it does not need a database
+		var mysqlRepo *repository.MysqlRepo
+		if !replayDryRun {
+			db, err := initDB(logger, viper.GetString("mysql.dsn"))
+			if err != nil {
+				return err
+			}
+
+			mysqlRepo, err = repository.NewMySQLRepo(logger, db)
+			if err != nil {
+				return err
+			}
+			defer closeRepo(logger, mysqlRepo)
+		}
+
+		handler, err := replayHandler(logger, mysqlRepo, opts.Group)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+
+		fmt.Printf("Replaying topic %s into %s with group %s (dry run: %t)\n", opts.Topic, replayProjection, opts.Group, replayDryRun)
+
+		started := time.Now()
+		handled, err := events.ReplayKafka(ctx, logger, opts, handler, func(progress events.ReplayProgress) {
+			if replayProgressEvery > 0 && progress.Handled%replayProgressEvery == 0 {
+				fmt.Printf("handled %d messages, partition %d at offset %d/%d\n",
+					progress.Handled, progress.Partition, progress.Offset+1, progress.End)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Replayed %d messages in %s\n", handled, time.Since(started).Round(time.Millisecond))
+		return nil
+	},
+}
+
+// replayHandler returns the handler of the requested projection, mysqlRepo is
+// nil for a dry run.
+func replayHandler(logger *zap.Logger, mysqlRepo *repository.MysqlRepo, group string) (events.Handler, error) {
+	projections := consumers.Projections(logger, mysqlRepo, group)
+	handler, ok := projections[replayProjection]
+	if !ok {
+		names := make([]string, 0, len(projections))
+		for name := range projections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown projection %q, available: %s", replayProjection, strings.Join(names, ", "))
+	}
+
+	if replayDryRun {
+		return func(ctx context.Context, message *events.Message) error {
+			return nil
+		}, nil
+	}
+	return handler, nil
+}
+
+func init() {
+	replayCmd.Flags().Int64Var(&replayFromOffset, "from-offset", -1, "offset to replay every partition from (default oldest)")
+	replayCmd.Flags().StringVar(&replayFromTimestamp, "from-timestamp", "", "RFC3339 time to replay from, instead of an offset")
+	replayCmd.Flags().StringVar(&replayGroup, "group", "", "consumer group used for the replay (default <kafka.consumer_group>-replay-<unix time>)")
+	replayCmd.Flags().StringVar(&replayProjection, "projection", consumers.Projection_CustomerActivities, "projection to rebuild")
+	replayCmd.Flags().BoolVar(&replayDryRun, "dry-run", false, "consume without writing to the projection")
+	replayCmd.Flags().Uint64Var(&replayProgressEvery, "progress-every", 1000, "print progress every n messages")
+
+	rootCmd.AddCommand(replayCmd)
+}
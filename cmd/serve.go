@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ginzap "github.com/gin-contrib/zap"
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/consumers"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/health"
+	"github.com/ldmtam/ecommerce-demo/internal/metrics"
+	"github.com/ldmtam/ecommerce-demo/internal/payments"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/relays"
+	"github.com/ldmtam/ecommerce-demo/internal/repository"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/ldmtam/ecommerce-demo/utils"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// The helpers below are shared by the start, serve-api and serve-consumer
+// commands, each of them only initialises the components it needs.
+
+func newLogger() (*zap.Logger, zap.AtomicLevel) {
+	logger, logLevel, err := utils.NewConfiguredLogger(utils.LoggerConfigFromViper())
+	if err != nil {
+		panic(err)
+	}
+
+	return logger, logLevel
+}
+
+func newMySQLRepo(logger *zap.Logger) *repository.MysqlRepo {
+	db, err := initDB(logger, viper.GetString("mysql.dsn"))
+	if err != nil {
+		panic(err)
+	}
+
+	mysqlRepo, err := repository.NewMySQLRepo(logger, db)
+	if err != nil {
+		panic(err)
+	}
+
+	return mysqlRepo
+}
+
+func newPaymentGateway(logger *zap.Logger) payments.Gateway {
+	gateway, err := payments.New(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	return gateway
+}
+
+func newPricer() *pricing.Pricer {
+	pricer, err := pricing.New()
+	if err != nil {
+		panic(err)
+	}
+
+	return pricer
+}
+
+func newSessions() *auth.Sessions {
+	sessions, err := auth.NewSessions()
+	if err != nil {
+		panic(err)
+	}
+
+	return sessions
+}
+
+// validateConfig fails fast on configuration errors which would otherwise only
+// show up once a component is used.
+func validateConfig() error {
+	if driver := viper.GetString("eventbus.driver"); driver == "" || driver == events.DriverKafka {
+		if err := events.ValidateKafkaConfig(); err != nil {
+			return fmt.Errorf("invalid kafka configuration: %w", err)
+		}
+	}
+	return nil
+}
+
+func startActivityConsumer(logger *zap.Logger, repo *repository.MysqlRepo, subscriber events.Subscriber) *consumers.ActivityConsumer {
+	activityConsumer, err := consumers.NewActivityConsumer(logger, repo, subscriber)
+	if err != nil {
+		panic(err)
+	}
+	if err := activityConsumer.Start(); err != nil {
+		panic(err)
+	}
+
+	return activityConsumer
+}
+
+func startOutboxRelay(logger *zap.Logger, repo *repository.MysqlRepo, publisher events.Publisher) *relays.OutboxRelay {
+	outboxRelay, err := relays.NewOutboxRelay(logger, repo, publisher)
+	if err != nil {
+		panic(err)
+	}
+	if err := outboxRelay.Start(); err != nil {
+		panic(err)
+	}
+
+	return outboxRelay
+}
+
+// flushPublisher gives in-flight messages a chance to be delivered before the
+// publisher is closed on shutdown.
+func flushPublisher(logger *zap.Logger, publisher events.Publisher) {
+	timeout := viper.GetDuration("kafka.producer.flush_timeout")
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := publisher.Flush(ctx); err != nil {
+		logger.Error("Flush event publisher failed", zap.Error(err))
+	}
+	if err := publisher.Close(); err != nil {
+		logger.Error("Close event publisher failed", zap.Error(err))
+	}
+}
+
+func initTracing(logger *zap.Logger) tracing.Shutdown {
+	shutdown, err := tracing.Init(logger)
+	if err != nil {
+		panic(err)
+	}
+
+	return shutdown
+}
+
+// shutdownTracing exports the spans still buffered, it runs last so the spans
+// of the shutdown itself are exported too.
+func shutdownTracing(logger *zap.Logger, shutdown tracing.Shutdown) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := shutdown(ctx); err != nil {
+		logger.Error("Shutdown tracing failed", zap.Error(err))
+	}
+}
+
+func newRouter(logger *zap.Logger) *gin.Engine {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.Default()
+	router.Use(requestid.Middleware())
+	router.Use(ginzap.GinzapWithConfig(logger, &ginzap.Config{
+		TimeFormat: time.RFC3339,
+		UTC:        true,
+		Context:    requestid.LogFields,
+	}))
+	router.Use(ginzap.RecoveryWithZap(logger, true))
+	router.Use(tracing.GinMiddleware())
+	router.Use(metrics.GinMiddleware())
+	router.GET("/metrics", metrics.Handler())
+
+	return router
+}
+
+func registerHealthRoutes(router *gin.Engine, healthz *health.Health) {
+	router.GET("/healthz", healthz.Liveness)
+	router.GET("/readyz", healthz.Readiness)
+}
+
+// registerAdminRoutes serves the log level, GET returns it and PUT with a
+// body like {"level":"debug"} changes it without restarting the process. The
+// guards restrict who may use it.
+func registerAdminRoutes(router *gin.Engine, logLevel zap.AtomicLevel, guards ...gin.HandlerFunc) {
+	admin := router.Group("/admin", guards...)
+	admin.GET("/log/level", gin.WrapH(logLevel))
+	admin.PUT("/log/level", gin.WrapH(logLevel))
+}
+
+// startDraining makes readiness fail and waits setting.drain_delay, so load
+// balancers stop routing new requests before the server stops accepting them.
+func startDraining(logger *zap.Logger, healthz *health.Health) {
+	healthz.SetDraining()
+
+	if delay := viper.GetDuration("setting.drain_delay"); delay > 0 {
+		logger.Info("Draining, waiting for load balancers...", zap.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+}
+
+func listenHTTP(logger *zap.Logger, router *gin.Engine, port int) *http.Server {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: router,
+	}
+
+	go func() {
+		logger.Info("Start listening http...", zap.Int("port", port))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	return server
+}
+
+// shutdownHTTP stops accepting connections and waits up to
+// setting.shutdown_timeout for the in-flight requests to complete.
+func shutdownHTTP(logger *zap.Logger, server *http.Server) {
+	timeout := viper.GetDuration("setting.shutdown_timeout")
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Draining http requests...", zap.Duration("timeout", timeout))
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error("Drain http requests failed", zap.Error(err))
+	}
+}
+
+func closeRepo(logger *zap.Logger, repo *repository.MysqlRepo) {
+	if err := repo.Close(); err != nil {
+		logger.Error("Close database failed", zap.Error(err))
+	}
+}
+
+// waitForSignal blocks until SIGINT or SIGTERM is received, then runs stop.
+// Components must be stopped from the outside in: http server, outbox relay,
+// event publisher, consumers, the database they all use and finally tracing.
+func waitForSignal(logger *zap.Logger, stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan bool)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	logger.Info("Server is now listening...")
+
+	go func() {
+		<-sigs
+		stop()
+		done <- true
+	}()
+
+	logger.Info("Ctrl-C to interrupt...")
+	<-done
+	logger.Info("Exiting...")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/handlers"
+	"github.com/ldmtam/ecommerce-demo/internal/health"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveAPICmd runs the http api and the outbox relay publishing the events it
+// records, without consuming them.
+var serveAPICmd = &cobra.Command{
+	Use:   "serve-api",
+	Short: "Run the http api only",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, logLevel := newLogger()
+		tracingShutdown := initTracing(logger)
+
+		mysqlRepo := newMySQLRepo(logger)
+
+		paymentGateway := newPaymentGateway(logger)
+
+		h, err := handlers.New(logger, mysqlRepo, newSessions(), paymentGateway, newPricer())
+		if err != nil {
+			panic(err)
+		}
+
+		if err := validateConfig(); err != nil {
+			panic(err)
+		}
+
+		publisher, err := events.NewPublisher(logger)
+		if err != nil {
+			panic(err)
+		}
+
+		outboxRelay := startOutboxRelay(logger, mysqlRepo, publisher)
+
+		healthz := health.New(logger)
+		healthz.Register("mysql", mysqlRepo)
+		healthz.Register("publisher", publisher)
+		healthz.Register("payments", paymentGateway)
+
+		router := newRouter(logger)
+		registerHealthRoutes(router, healthz)
+		registerAdminRoutes(router, logLevel, h.Authorize(auth.Permission_ManageSettings)...)
+		v1 := router.Group("/api/v1")
+		{
+			v1.GET("/ping", h.Ping) // for health check
+			h.RegisterRoutes(v1)
+		}
+
+		server := listenHTTP(logger, router, viper.GetInt("setting.port"))
+
+		logger.Info("Starting api...")
+
+		waitForSignal(logger, func() {
+			startDraining(logger, healthz)
+			shutdownHTTP(logger, server)
+			outboxRelay.Stop()
+			flushPublisher(logger, publisher)
+			closeRepo(logger, mysqlRepo)
+			shutdownTracing(logger, tracingShutdown)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveAPICmd)
+}
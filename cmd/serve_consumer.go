@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/handlers"
+	"github.com/ldmtam/ecommerce-demo/internal/health"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// serveConsumerCmd runs the activity consumer, with a small http server on
+// setting.consumer_port for health checks and consumer status. The admin and
+// status routes need a session or api key allowed to manage settings, so the
+// consumer is configured with the same auth.session_secret as the api.
+var serveConsumerCmd = &cobra.Command{
+	Use:   "serve-consumer",
+	Short: "Run the activity consumer only",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, logLevel := newLogger()
+		tracingShutdown := initTracing(logger)
+
+		mysqlRepo := newMySQLRepo(logger)
+
+		// sessions are verified to guard the admin and status routes, nothing is paid
+		h, err := handlers.New(logger, mysqlRepo, newSessions(), nil, nil)
+		if err != nil {
+			panic(err)
+		}
+
+		if err := validateConfig(); err != nil {
+			panic(err)
+		}
+
+		subscriber, err := events.NewSubscriber(logger)
+		if err != nil {
+			panic(err)
+		}
+
+		activityConsumer := startActivityConsumer(logger, mysqlRepo, subscriber)
+
+		healthz := health.New(logger)
+		healthz.Register("mysql", mysqlRepo)
+		healthz.Register("consumer", activityConsumer)
+
+		router := newRouter(logger)
+		registerHealthRoutes(router, healthz)
+		registerAdminRoutes(router, logLevel, h.Authorize(auth.Permission_ManageSettings)...)
+		v1 := router.Group("/api/v1")
+		{
+			v1.GET("/ping", h.Ping) // for health check
+			h.RegisterConsumerStatus(v1, activityConsumer)
+		}
+
+		server := listenHTTP(logger, router, viper.GetInt("setting.consumer_port"))
+
+		logger.Info("Starting consumer...")
+
+		waitForSignal(logger, func() {
+			startDraining(logger, healthz)
+			shutdownHTTP(logger, server)
+			activityConsumer.Stop()
+			closeRepo(logger, mysqlRepo)
+			shutdownTracing(logger, tracingShutdown)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveConsumerCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/ldmtam/ecommerce-demo/internal/payments"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// servePaymentStubCmd runs a fake payment gateway over http on
+// payments.stub.port, for the api configured with the http payments driver.
+var servePaymentStubCmd = &cobra.Command{
+	Use:   "serve-payment-stub",
+	Short: "Run a fake payment gateway over http",
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, _ := newLogger()
+
+		gateway, err := payments.NewFakeGateway()
+		if err != nil {
+			panic(err)
+		}
+
+		router := newRouter(logger)
+		payments.NewStubServer(logger, gateway).RegisterRoutes(router)
+
+		server := listenHTTP(logger, router, viper.GetInt("payments.stub.port"))
+
+		logger.Info("Starting payment stub...")
+
+		waitForSignal(logger, func() {
+			shutdownHTTP(logger, server)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(servePaymentStubCmd)
+}
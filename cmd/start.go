@@ -2,22 +2,16 @@ package cmd
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
-	ginzap "github.com/gin-contrib/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
-	"github.com/gin-gonic/gin"
-	"github.com/ldmtam/ecommerce-demo/internal/consumers"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
 	"github.com/ldmtam/ecommerce-demo/internal/handlers"
+	"github.com/ldmtam/ecommerce-demo/internal/health"
 	"github.com/ldmtam/ecommerce-demo/internal/models"
-	"github.com/ldmtam/ecommerce-demo/internal/repository"
-	"github.com/ldmtam/ecommerce-demo/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -40,80 +34,71 @@ func initDB(logger *zap.Logger, dsn string) (*gorm.DB, error) {
 
 	logger.Info("Successfully connected to database")
 
-	db.AutoMigrate(models.Product{}, models.CustomerActivity{})
+	db.AutoMigrate(models.Product{}, models.CustomerActivity{}, models.OutboxMessage{}, models.Customer{}, models.APIKey{}, models.Visitor{}, models.VisitorActivity{}, models.CartItem{}, models.Order{}, models.OrderItem{}, models.Promotion{}, models.WishlistItem{}, models.Notification{})
 
 	return db, nil
 }
 
+// startCmd runs the api and the activity consumer in a single process, see
+// serve-api and serve-consumer to run and scale them separately.
 var startCmd = &cobra.Command{
 	Use: "start",
 	Run: func(cmd *cobra.Command, args []string) {
-		logger := utils.NewLogger(viper.GetString("setting.log_path"))
+		logger, logLevel := newLogger()
+		tracingShutdown := initTracing(logger)
 
-		db, err := initDB(logger, viper.GetString("mysql.dsn"))
-		if err != nil {
-			panic(err)
-		}
+		mysqlRepo := newMySQLRepo(logger)
 
-		mysqlRepo, err := repository.NewMySQLRepo(logger, db)
+		paymentGateway := newPaymentGateway(logger)
+
+		h, err := handlers.New(logger, mysqlRepo, newSessions(), paymentGateway, newPricer())
 		if err != nil {
 			panic(err)
 		}
 
-		h, err := handlers.New(logger, mysqlRepo)
-		if err != nil {
+		if err := validateConfig(); err != nil {
 			panic(err)
 		}
 
-		activityConsumer, err := consumers.NewActivityConsumer(logger, mysqlRepo)
+		publisher, subscriber, err := events.New(logger)
 		if err != nil {
 			panic(err)
 		}
-		if err := activityConsumer.Start(); err != nil {
-			panic(err)
-		}
 
-		gin.SetMode(gin.ReleaseMode)
-		router := gin.Default()
-		router.Use(ginzap.Ginzap(logger, time.RFC3339, true))
-		router.Use(ginzap.RecoveryWithZap(logger, true))
+		// subscribe before relaying, the in-memory bus drops messages of
+		// topics nobody subscribed to
+		activityConsumer := startActivityConsumer(logger, mysqlRepo, subscriber)
+		outboxRelay := startOutboxRelay(logger, mysqlRepo, publisher)
+
+		healthz := health.New(logger)
+		healthz.Register("mysql", mysqlRepo)
+		healthz.Register("publisher", publisher)
+		healthz.Register("payments", paymentGateway)
+		healthz.Register("consumer", activityConsumer)
 
+		router := newRouter(logger)
+		registerHealthRoutes(router, healthz)
+		registerAdminRoutes(router, logLevel, h.Authorize(auth.Permission_ManageSettings)...)
 		v1 := router.Group("/api/v1")
 		{
 			v1.GET("/ping", h.Ping) // for health check
-
-			v1.POST("/products", h.CreateProduct)
-			v1.GET("/products/:id", h.GetProduct)
-			v1.GET("/products/seachByName/:name", h.SearchProductByName)
-			v1.GET("/customer_activities/:id", h.GetCustomerActivites)
-			v1.GET("/customer_activities/:id/actions/:action_type", h.GetCustomerActivitesByAction)
+			h.RegisterConsumerStatus(v1, activityConsumer)
+			h.RegisterRoutes(v1)
 		}
 
-		go func() {
-			port := viper.GetInt("setting.port")
-			logger.Info("Start listening http...", zap.Int("port", port))
-			if err := router.Run(fmt.Sprintf(":%d", port)); err != nil {
-				panic(err)
-			}
-		}()
+		server := listenHTTP(logger, router, viper.GetInt("setting.port"))
 
 		logger.Info("Starting service...")
 
-		sigs := make(chan os.Signal, 1)
-		done := make(chan bool)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-		logger.Info("Server is now listening...")
-
-		go func() {
-			<-sigs
+		waitForSignal(logger, func() {
+			startDraining(logger, healthz)
+			shutdownHTTP(logger, server)
+			outboxRelay.Stop()
+			flushPublisher(logger, publisher)
 			activityConsumer.Stop()
-			done <- true
-		}()
-
-		logger.Info("Ctrl-C to interrupt...")
-		<-done
-		logger.Info("Exiting...")
+			closeRepo(logger, mysqlRepo)
+			shutdownTracing(logger, tracingShutdown)
+		})
 	},
 }
 
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownScope = errors.New("unknown api key scope")
+	ErrNoScope      = errors.New("an api key needs at least one scope")
+	ErrKeyRevoked   = errors.New("api key is revoked")
+)
+
+// apiKeyPrefix tells api keys apart from session tokens in the Authorization
+// header.
+var apiKeyPrefix = "ek_"
+
+// apiKeyScopes are the permissions which can be granted to an api key.
+var apiKeyScopes = []string{
+	Permission_ReadProducts,
+	Permission_WriteProducts,
+	Permission_ReadActivities,
+	Permission_ReadOrders,
+	Permission_ManageOrders,
+}
+
+// GenerateAPIKey returns a new key, to be shown once, with its display prefix
+// and the hash to store.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:len(apiKeyPrefix)+8], HashAPIKey(key), nil
+}
+
+// HashAPIKey is the hash a key is stored and looked up with. Keys are random,
+// a fast hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return ErrNoScope
+	}
+	for _, scope := range scopes {
+		if !contains(apiKeyScopes, scope) {
+			return ErrUnknownScope
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
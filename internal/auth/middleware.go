@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"gorm.io/gorm"
+)
+
+type customerKey struct{}
+
+type apiKeyKey struct{}
+
+func NewContext(ctx context.Context, customerID uint) context.Context {
+	return context.WithValue(ctx, customerKey{}, customerID)
+}
+
+// CustomerID returns the authenticated customer of ctx.
+func CustomerID(ctx context.Context) (uint, bool) {
+	customerID, ok := ctx.Value(customerKey{}).(uint)
+	return customerID, ok && customerID != 0
+}
+
+func NewAPIKeyContext(ctx context.Context, key *models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, key)
+}
+
+// APIKey returns the api key ctx was authenticated with.
+func APIKey(ctx context.Context) (*models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(*models.APIKey)
+	return key, ok && key != nil
+}
+
+type apiKeyStore interface {
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+}
+
+// Authenticator authenticates customers with their session and partner
+// systems with their api key.
+type Authenticator struct {
+	sessions *Sessions
+	keys     apiKeyStore
+}
+
+func NewAuthenticator(sessions *Sessions, keys apiKeyStore) *Authenticator {
+	return &Authenticator{
+		sessions: sessions,
+		keys:     keys,
+	}
+}
+
+// Middleware rejects unauthenticated requests with 401. The session is read
+// from the session cookie or from an "Authorization: Bearer" header, which
+// also carries api keys. The customer or the api key is put in the request
+// context.
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return a.middleware(false)
+}
+
+// Optional authenticates the request like Middleware but lets requests
+// without credentials through anonymously. A session cookie which expired or
+// is invalid is ignored as well, so that a visitor is not locked out by an
+// old cookie; invalid credentials sent in the header are still rejected.
+func (a *Authenticator) Optional() gin.HandlerFunc {
+	return a.middleware(true)
+}
+
+func (a *Authenticator) middleware(optional bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, fromCookie := a.tokenOf(c)
+		if token == "" && optional {
+			c.Next()
+			return
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication is required"})
+			return
+		}
+
+		if isAPIKey(token) {
+			key, err := a.keys.GetAPIKeyByHash(c.Request.Context(), HashAPIKey(token))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "api key is invalid"})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Get api key failed"})
+				return
+			}
+			if key.IsRevoked() {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrKeyRevoked.Error()})
+				return
+			}
+
+			c.Request = c.Request.WithContext(NewAPIKeyContext(c.Request.Context(), key))
+			c.Next()
+			return
+		}
+
+		customerID, err := a.sessions.Verify(token)
+		if err != nil && optional && fromCookie {
+			c.Next()
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), customerID))
+		c.Next()
+	}
+}
+
+// tokenOf returns the token of the request and whether it was read from the
+// session cookie.
+func (a *Authenticator) tokenOf(c *gin.Context) (string, bool) {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer "), false
+	}
+	token, _ := c.Cookie(a.sessions.cookieName)
+	return token, true
+}
+
+// SetCookie stores the session token in an http only cookie.
+func (s *Sessions) SetCookie(c *gin.Context, token string, expiresAt time.Time) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(s.cookieName, token, int(time.Until(expiresAt).Seconds()), "/", "", s.cookieSecure, true)
+}
+
+func (s *Sessions) ClearCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(s.cookieName, "", -1, "/", "", s.cookieSecure, true)
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+var (
+	Permission_ReadProducts     = "products:read"
+	Permission_WriteProducts    = "products:write"
+	Permission_ReadActivities   = "activities:read"
+	Permission_ManageSettings   = "settings:manage"
+	Permission_ManageAPIKeys    = "api_keys:manage"
+	Permission_ManageCart       = "cart:manage"
+	Permission_PlaceOrders      = "orders:place"
+	Permission_ReadOrders       = "orders:read"
+	Permission_ManageOrders     = "orders:manage"
+	Permission_ManagePromotions = "promotions:manage"
+	Permission_ManageWishlist   = "wishlist:manage"
+	Permission_ReadInbox        = "inbox:read"
+)
+
+// rolePermissions lists what every role may do.
+var rolePermissions = map[string][]string{
+	models.Role_Admin: {
+		Permission_ReadProducts,
+		Permission_WriteProducts,
+		Permission_ReadActivities,
+		Permission_ManageSettings,
+		Permission_ManageAPIKeys,
+		Permission_ManageCart,
+		Permission_PlaceOrders,
+		Permission_ManageWishlist,
+		Permission_ReadInbox,
+		Permission_ReadOrders,
+		Permission_ManageOrders,
+		Permission_ManagePromotions,
+	},
+	models.Role_Merchandiser: {
+		Permission_ReadProducts,
+		Permission_WriteProducts,
+		Permission_ManageCart,
+		Permission_PlaceOrders,
+		Permission_ManageWishlist,
+		Permission_ReadInbox,
+		Permission_ManagePromotions,
+	},
+	models.Role_Support: {
+		Permission_ReadProducts,
+		Permission_ReadActivities,
+		Permission_ManageCart,
+		Permission_PlaceOrders,
+		Permission_ManageWishlist,
+		Permission_ReadInbox,
+		Permission_ReadOrders,
+	},
+	models.Role_Customer: {
+		Permission_ReadProducts,
+		Permission_ManageCart,
+		Permission_PlaceOrders,
+		Permission_ManageWishlist,
+		Permission_ReadInbox,
+	},
+}
+
+// anonymousPermissions lists what visitors who are not logged in may do.
+var anonymousPermissions = []string{
+	Permission_ReadProducts,
+	Permission_ManageCart,
+}
+
+// ValidateRole returns ErrUnknownRole unless role is one of the models.Role_
+// values.
+func ValidateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return ErrUnknownRole
+	}
+	return nil
+}
+
+// Can reports whether role has permission.
+func Can(role, permission string) bool {
+	return contains(rolePermissions[role], permission)
+}
+
+type roleStore interface {
+	GetCustomerRole(ctx context.Context, id uint) (string, error)
+}
+
+// RequirePermission rejects requests of customers whose role lacks
+// permission, or of api keys without the permission in their scopes, with 403.
+// It must run after the authentication middleware. The role is read on every
+// request, so a role change applies to existing sessions. Anonymous requests,
+// which only pass the optional authentication, are allowed the anonymous
+// permissions.
+func RequirePermission(store roleStore, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := APIKey(c.Request.Context()); ok {
+			if !contains(key.Scopes, permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		customerID, ok := CustomerID(c.Request.Context())
+		if !ok && contains(anonymousPermissions, permission) {
+			c.Next()
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication is required"})
+			return
+		}
+
+		role, err := store.GetCustomerRole(c.Request.Context(), customerID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "customer no longer exists"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Get customer role failed"})
+			return
+		}
+
+		if !Can(role, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+
+		c.Next()
+	}
+}
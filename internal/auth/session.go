@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrMissingSecret = errors.New("auth.session_secret must be at least 32 bytes")
+	ErrInvalidToken  = errors.New("session token is invalid")
+	ErrTokenExpired  = errors.New("session token is expired")
+)
+
+var (
+	defaultSessionTTL = 24 * time.Hour
+	defaultCookieName = "session"
+	minSecretLength   = 32
+)
+
+// Sessions issues and verifies session tokens. A token is the customer id and
+// the expiry time signed with HMAC-SHA256, nothing is stored server side.
+type Sessions struct {
+	secret            []byte
+	ttl               time.Duration
+	cookieName        string
+	cookieSecure      bool
+	visitorCookieName string
+	visitorTTL        time.Duration
+	now               func() time.Time
+}
+
+func NewSessions() (*Sessions, error) {
+	secret := viper.GetString("auth.session_secret")
+	if len(secret) < minSecretLength {
+		return nil, ErrMissingSecret
+	}
+	ttl := viper.GetDuration("auth.session_ttl")
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	cookieName := viper.GetString("auth.cookie_name")
+	if cookieName == "" {
+		cookieName = defaultCookieName
+	}
+	visitorCookieName := viper.GetString("auth.visitor_cookie_name")
+	if visitorCookieName == "" {
+		visitorCookieName = defaultVisitorCookieName
+	}
+	visitorTTL := viper.GetDuration("auth.visitor_ttl")
+	if visitorTTL <= 0 {
+		visitorTTL = defaultVisitorTTL
+	}
+
+	return &Sessions{
+		secret:            []byte(secret),
+		ttl:               ttl,
+		cookieName:        cookieName,
+		cookieSecure:      viper.GetBool("auth.cookie_secure"),
+		visitorCookieName: visitorCookieName,
+		visitorTTL:        visitorTTL,
+		now:               time.Now,
+	}, nil
+}
+
+// Issue returns a token authenticating the customer until the returned time.
+func (s *Sessions) Issue(customerID uint) (string, time.Time) {
+	expiresAt := s.now().Add(s.ttl)
+	payload := strconv.FormatUint(uint64(customerID), 10) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+	return encoded + "." + s.sign(encoded), expiresAt
+}
+
+// Verify returns the customer the token was issued to.
+func (s *Sessions) Verify(token string) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return 0, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(s.sign(parts[0]))) {
+		return 0, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 2 {
+		return 0, ErrInvalidToken
+	}
+	customerID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil || customerID == 0 {
+		return 0, ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	if s.now().Unix() >= expiresAt {
+		return 0, ErrTokenExpired
+	}
+
+	return uint(customerID), nil
+}
+
+func (s *Sessions) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	viper.Set("auth.session_secret", "0123456789abcdef0123456789abcdef")
+	viper.Set("auth.session_ttl", "1h")
+	defer viper.Reset()
+
+	sessions, err := NewSessions()
+	assert.Nil(t, err)
+	token, _ := sessions.Issue(42)
+
+	viper.Set("auth.session_secret", "fedcba9876543210fedcba9876543210")
+	otherSessions, err := NewSessions()
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		sessions    *Sessions
+		token       string
+		now         time.Time
+		expectedID  uint
+		expectedErr error
+	}{
+		"valid token": {
+			sessions:   sessions,
+			token:      token,
+			now:        time.Now(),
+			expectedID: 42,
+		},
+		"expired token": {
+			sessions:    sessions,
+			token:       token,
+			now:         time.Now().Add(2 * time.Hour),
+			expectedErr: ErrTokenExpired,
+		},
+		"tampered payload": {
+			sessions:    sessions,
+			token:       "NDMuOTk5OTk5OTk5OQ" + token[len(token)-44:],
+			now:         time.Now(),
+			expectedErr: ErrInvalidToken,
+		},
+		"signed with another secret": {
+			sessions:    otherSessions,
+			token:       token,
+			now:         time.Now(),
+			expectedErr: ErrInvalidToken,
+		},
+		"malformed token": {
+			sessions:    sessions,
+			token:       "not-a-token",
+			now:         time.Now(),
+			expectedErr: ErrInvalidToken,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := test.now
+			test.sessions.now = func() time.Time { return now }
+
+			customerID, err := test.sessions.Verify(test.token)
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, test.expectedID, customerID)
+		})
+	}
+}
+
+func TestNewSessionsRequiresSecret(t *testing.T) {
+	viper.Set("auth.session_secret", "too short")
+	defer viper.Reset()
+
+	_, err := NewSessions()
+	assert.ErrorIs(t, err, ErrMissingSecret)
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, CheckPassword(hash, "correct horse battery staple"))
+	assert.False(t, CheckPassword(hash, "correct horse"))
+	// unknown accounts never match, not even the dummy password
+	assert.False(t, CheckPassword("", "dummy password"))
+
+	_, err = HashPassword("short")
+	assert.ErrorIs(t, err, ErrPasswordTooShort)
+}
+
+func TestAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	assert.Nil(t, err)
+	assert.True(t, isAPIKey(key))
+	assert.True(t, len(prefix) < len(key) && key[:len(prefix)] == prefix)
+	assert.Equal(t, hash, HashAPIKey(key))
+
+	other, _, _, err := GenerateAPIKey()
+	assert.Nil(t, err)
+	assert.NotEqual(t, key, other)
+
+	assert.Nil(t, ValidateScopes([]string{Permission_ReadProducts, Permission_ReadActivities}))
+	assert.ErrorIs(t, ValidateScopes(nil), ErrNoScope)
+	assert.ErrorIs(t, ValidateScopes([]string{Permission_ManageAPIKeys}), ErrUnknownScope)
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	defaultVisitorCookieName = "visitor_id"
+	defaultVisitorTTL        = 365 * 24 * time.Hour
+	visitorIDBytes           = 16
+)
+
+type visitorKey struct{}
+
+func NewVisitorContext(ctx context.Context, visitorID string) context.Context {
+	return context.WithValue(ctx, visitorKey{}, visitorID)
+}
+
+// VisitorID returns the anonymous visitor of ctx.
+func VisitorID(ctx context.Context) (string, bool) {
+	visitorID, ok := ctx.Value(visitorKey{}).(string)
+	return visitorID, ok && visitorID != ""
+}
+
+// Visitors identifies the requests of anonymous visitors with the visitor
+// cookie, a new visitor id is issued when the cookie is missing or its
+// signature is invalid. The cookie is signed so that a visitor cannot take
+// the id of another one, and the browsing history with it on login.
+// Customers and api keys are left alone, the middleware must run after the
+// authentication one.
+func (s *Sessions) Visitors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CustomerID(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+		if _, ok := APIKey(c.Request.Context()); ok {
+			c.Next()
+			return
+		}
+
+		visitorID, ok := s.Visitor(c)
+		if !ok {
+			id := make([]byte, visitorIDBytes)
+			if _, err := rand.Read(id); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Issue visitor id failed"})
+				return
+			}
+			visitorID = hex.EncodeToString(id)
+
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(s.visitorCookieName, visitorID+"."+s.sign(visitorID), int(s.visitorTTL.Seconds()), "/", "", s.cookieSecure, true)
+		}
+
+		c.Request = c.Request.WithContext(NewVisitorContext(c.Request.Context(), visitorID))
+		c.Next()
+	}
+}
+
+// Visitor returns the visitor id of the visitor cookie of the request.
+func (s *Sessions) Visitor(c *gin.Context) (string, bool) {
+	cookie, err := c.Cookie(s.visitorCookieName)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.Split(cookie, ".")
+	if len(parts) != 2 || len(parts[0]) != 2*visitorIDBytes {
+		return "", false
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(s.sign(parts[0]))) {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+// ClearVisitorCookie forgets the visitor, the next anonymous request is given
+// a new visitor id.
+func (s *Sessions) ClearVisitorCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(s.visitorCookieName, "", -1, "/", "", s.cookieSecure, true)
+}
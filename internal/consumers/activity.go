@@ -2,156 +2,232 @@ package consumers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
-	"github.com/Shopify/sarama"
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/metrics"
 	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 type repository interface {
-	CreateCustomerActivity(userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error)
+	CreateCustomerActivity(ctx context.Context, eventID string, userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error)
+	CreateVisitorActivity(ctx context.Context, eventID, visitorID string, createdAt int64, action, data string) error
+	IdentifyVisitor(ctx context.Context, visitorID string, customerID uint) error
+	NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error)
 }
 
+var (
+	ErrNotStarted = errors.New("consumer is not started")
+)
+
+var (
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
 type ActivityConsumer struct {
-	logger   *zap.Logger
-	repo     repository
-	client   sarama.ConsumerGroup
-	ready    chan bool
-	ctx      context.Context
-	cancelFn context.CancelFunc
+	logger       *zap.Logger
+	repo         repository
+	subscriber   events.Subscriber
+	subscription events.Subscription
+	group        string
+	retryBackoff time.Duration
+	stats        *statsRecorder
 }
 
-func NewActivityConsumer(logger *zap.Logger, repo repository) (*ActivityConsumer, error) {
-	client, err := initConsumer(logger, viper.GetStringSlice("kafka.brokers"))
+func NewActivityConsumer(logger *zap.Logger, repo repository, subscriber events.Subscriber) (*ActivityConsumer, error) {
+	return &ActivityConsumer{
+		logger:       logger,
+		repo:         repo,
+		subscriber:   subscriber,
+		group:        viper.GetString("kafka.consumer_group"),
+		retryBackoff: defaultRetryBackoff,
+		stats:        newStatsRecorder(),
+	}, nil
+}
+
+func (c *ActivityConsumer) Start() error {
+	subscription, err := c.subscriber.Subscribe(
+		viper.GetString("kafka.topic"),
+		c.group,
+		c.handle)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	c.subscription = subscription
 
-	return &ActivityConsumer{
-		logger:   logger,
-		repo:     repo,
-		client:   client,
-		ready:    make(chan bool),
-		ctx:      ctx,
-		cancelFn: cancel,
-	}, nil
+	return nil
 }
 
-func (c *ActivityConsumer) Start() error {
-	go func() {
-		for {
-			// `Consume` should be called inside an infinite loop, when a
-			// server-side rebalance happens, the consumer session will need to be
-			// recreated to get the new claims
-			if err := c.client.Consume(
-				c.ctx,
-				[]string{viper.GetString("kafka.topic")},
-				&consumerHandler{c: c}); err != nil {
-				c.logger.Error("Error from consumer", zap.Error(err))
-			}
-			// check if context was cancelled, signaling that the consumer should stop
-			if c.ctx.Err() != nil {
-				return
-			}
-			c.ready = make(chan bool)
-		}
-	}()
+// handle stores one activity. Activities are keyed by user, or by visitor for
+// anonymous visitors, so all activities of a user are in the same partition
+// and are handled one by one. A failed insert is retried instead of skipped,
+// which keeps the writes of every user in the order they were produced. The
+// login of a visitor is keyed by visitor too, it is handled after every
+// activity the visitor made before logging in. Price drops are keyed by
+// product.
+func (c *ActivityConsumer) handle(ctx context.Context, message *events.Message) error {
+	customerActivity := &models.CustomerActivity{}
+	if err := json.Unmarshal(message.Value, customerActivity); err != nil {
+		// a malformed message will never succeed, skip it
+		requestid.Logger(ctx, c.logger).Error("Parse json failed",
+			zap.Error(err),
+			zap.String("topic", message.Topic),
+			zap.Int32("partition", message.Partition),
+			zap.Int64("offset", message.Offset),
+			zap.String("message", string(message.Value)))
+		c.recordResult(message, metrics.Result_Failure)
+		return nil
+	}
+	// events published before they carried an id are identified by their
+	// position in the topic, which a redelivery keeps
+	if customerActivity.EventID == "" {
+		customerActivity.EventID = messageEventID(message)
+	}
 
-	<-c.ready
+	insertLatency, err := c.storeActivity(ctx, customerActivity)
+	if err != nil {
+		c.recordResult(message, metrics.Result_Failure)
+		return err
+	}
 
+	c.stats.record(insertLatency, time.Now())
+	c.recordResult(message, metrics.Result_Success)
+	requestid.Logger(ctx, c.logger).Debug("Stored customer activity",
+		zap.Uint("user_id", customerActivity.UserID),
+		zap.String("visitor_id", customerActivity.VisitorID),
+		zap.String("action", customerActivity.Action),
+		zap.Int32("partition", message.Partition),
+		zap.Int64("offset", message.Offset))
 	return nil
 }
 
-type consumerHandler struct {
-	c *ActivityConsumer
+// messageEventID identifies a message by its position in its topic.
+func messageEventID(message *events.Message) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)))
+	return hex.EncodeToString(sum[:])
 }
 
-// Setup is run at the beginning of a new session, before ConsumeClaim
-func (handler *consumerHandler) Setup(sarama.ConsumerGroupSession) error {
-	// Mark the consumer as ready
-	close(handler.c.ready)
-	return nil
+func (c *ActivityConsumer) recordResult(message *events.Message, result string) {
+	metrics.ConsumerMessages.WithLabelValues(message.Topic, c.group, result).Inc()
 }
 
-// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
-func (handler *consumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
-	return nil
+// Stats reports the throughput of the consumer since it started, and its lag
+// from the offsets committed by the group at the time of the call.
+func (c *ActivityConsumer) Stats() ConsumerStats {
+	stats := c.stats.snapshot(time.Now())
+	stats.Topic = viper.GetString("kafka.topic")
+	stats.Group = c.group
+
+	if c.subscription == nil {
+		return stats
+	}
+	lags, err := c.subscription.Lag()
+	if err != nil {
+		c.logger.Error("Read consumer lag failed", zap.Error(err))
+		return stats
+	}
+	for _, lag := range lags {
+		stats.TotalLag += lag.Lag
+	}
+	stats.Partitions = lags
+
+	return stats
 }
 
-// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
-func (handler *consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	// NOTE:
-	// Do not move the code below to a goroutine.
-	// The `ConsumeClaim` itself is called within a goroutine, see:
-	// https://github.com/Shopify/sarama/blob/main/consumer_group.go#L27-L29
+// storeActivity inserts the activity, retrying with an exponential backoff
+// until it succeeds or ctx is done. The latency of the successful insert is
+// returned.
+func (c *ActivityConsumer) storeActivity(ctx context.Context, activity *models.CustomerActivity) (time.Duration, error) {
+	backoff := c.retryBackoff
 	for {
+		started := time.Now()
+		err := c.write(ctx, activity)
+		if err == nil {
+			return time.Since(started), nil
+		}
+
+		requestid.Logger(ctx, c.logger).Error("Create customer activity failed, retrying",
+			zap.Error(err),
+			zap.Duration("backoff", backoff),
+			zap.Reflect("customer activity", activity))
+
 		select {
-		case message := <-claim.Messages():
-			handler.c.logger.Info("Message claimed",
-				zap.Time("timestamp", message.Timestamp),
-				zap.String("topic", message.Topic),
-				zap.Int32("partition", message.Partition),
-				zap.Int64("offset", message.Offset))
-
-			customerActivity := &models.CustomerActivity{}
-			if err := json.Unmarshal(message.Value, customerActivity); err != nil {
-				handler.c.logger.Error("Parse json failed",
-					zap.Error(err),
-					zap.String("topic", message.Topic),
-					zap.Int32("partition", message.Partition),
-					zap.Int64("offset", message.Offset),
-					zap.String("message", string(message.Value)))
-				continue
-			}
-
-			if _, err := handler.c.repo.CreateCustomerActivity(
-				customerActivity.UserID,
-				customerActivity.CreatedAt,
-				customerActivity.Action,
-				customerActivity.Data,
-			); err != nil {
-				handler.c.logger.Error("Create customer activity failed",
-					zap.Error(err),
-					zap.Reflect("customer activity", customerActivity))
-				continue
-			}
-
-			session.MarkMessage(message, "")
-
-		// Should return when `session.Context()` is done.
-		// If not, will r`aise `ErrRebalanceInProgress` or `read tcp <ip>:<port>: i/o timeout` when kafka rebalance. see:
-		// https://github.com/Shopify/sarama/issues/1192
-		case <-session.Context().Done():
-			return nil
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
 		}
 	}
 }
 
-func (c *ActivityConsumer) Stop() {
-	c.cancelFn()
-	<-c.ctx.Done()
+// write stores the activity for its customer or its visitor, stitches the
+// history of the visitor to the customer when the visitor logged in, or
+// notifies the wishlists of a product whose price dropped.
+func (c *ActivityConsumer) write(ctx context.Context, activity *models.CustomerActivity) error {
+	switch {
+	case activity.Action == models.CustomAction_IdentifyVisitor:
+		return c.repo.IdentifyVisitor(ctx, activity.VisitorID, activity.UserID)
+	case activity.Action == models.CustomAction_PriceDropped:
+		return c.notifyPriceDrop(ctx, activity)
+	case activity.UserID == 0 && activity.VisitorID != "":
+		return c.repo.CreateVisitorActivity(ctx, activity.EventID, activity.VisitorID, activity.CreatedAt, activity.Action, activity.Data)
+	default:
+		_, err := c.repo.CreateCustomerActivity(ctx, activity.EventID, activity.UserID, activity.CreatedAt, activity.Action, activity.Data)
+		return err
+	}
 }
 
-func initConsumer(logger *zap.Logger, brokers []string) (sarama.ConsumerGroup, error) {
-	logger.Info("Creating kafka consumer...")
-
-	cfg := sarama.NewConfig()
-	cfg.Version = sarama.V1_0_0_0
-	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+// notifyPriceDrop notifies the customers having the product of the price drop
+// in their wishlist. A drop without a product will never succeed, it is
+// skipped.
+func (c *ActivityConsumer) notifyPriceDrop(ctx context.Context, activity *models.CustomerActivity) error {
+	drop := &models.PriceDrop{}
+	if err := json.Unmarshal([]byte(activity.Data), drop); err != nil || drop.ProductID == 0 {
+		requestid.Logger(ctx, c.logger).Error("Parse price drop failed", zap.Error(err), zap.String("data", activity.Data))
+		return nil
+	}
 
-	consumerGroup, err := sarama.NewConsumerGroup(
-		viper.GetStringSlice("kafka.brokers"),
-		viper.GetString("kafka.consumer_group"),
-		cfg)
+	notified, err := c.repo.NotifyPriceDrop(ctx, drop, activity.CreatedAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	logger.Info("Successfully created kafka consumer")
+	requestid.Logger(ctx, c.logger).Info("Notified price drop",
+		zap.Uint("product_id", drop.ProductID),
+		zap.Uint("old_price", drop.OldPrice),
+		zap.Uint("new_price", drop.NewPrice),
+		zap.Int64("notified", notified))
+	return nil
+}
 
-	return consumerGroup, nil
+// Check reports whether the consumer currently receives activities.
+func (c *ActivityConsumer) Check(ctx context.Context) error {
+	if c.subscription == nil {
+		return ErrNotStarted
+	}
+	return c.subscription.Check(ctx)
+}
+
+func (c *ActivityConsumer) Stop() {
+	if c.subscription == nil {
+		return
+	}
+
+	if err := c.subscription.Close(); err != nil {
+		c.logger.Error("Close activity subscription failed", zap.Error(err))
+	}
 }
@@ -0,0 +1,322 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/ldmtam/ecommerce-demo/internal/metrics"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// flakyRepo fails every third insert and records the successful ones per user.
+type flakyRepo struct {
+	mu      sync.Mutex
+	calls   int
+	written map[uint][]int64
+}
+
+func (r *flakyRepo) CreateCustomerActivity(ctx context.Context, eventID string, userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.calls%3 == 0 {
+		return nil, errors.New("database is unavailable")
+	}
+
+	r.written[userID] = append(r.written[userID], createdAt)
+	return &models.CustomerActivity{UserID: userID, CreatedAt: createdAt, Action: action, Data: data}, nil
+}
+
+func (r *flakyRepo) CreateVisitorActivity(ctx context.Context, eventID, visitorID string, createdAt int64, action, data string) error {
+	return errors.New("visitors are not supported")
+}
+
+func (r *flakyRepo) NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error) {
+	return 0, errors.New("price drops are not supported")
+}
+
+func (r *flakyRepo) IdentifyVisitor(ctx context.Context, visitorID string, customerID uint) error {
+	return errors.New("visitors are not supported")
+}
+
+func (r *flakyRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, written := range r.written {
+		count += len(written)
+	}
+	return count
+}
+
+func TestActivityConsumerKeepsPerUserOrder(t *testing.T) {
+	const (
+		numUsers = 8
+		perUser  = 25
+	)
+
+	viper.Set("kafka.topic", "product-activities")
+	viper.Set("kafka.consumer_group", "user-activities-test")
+	viper.Set("eventbus.memory.partitions", 4)
+	defer viper.Reset()
+
+	bus := events.NewMemoryBus(zap.NewNop())
+	defer bus.Close()
+
+	repo := &flakyRepo{written: make(map[uint][]int64)}
+	consumer, err := NewActivityConsumer(zap.NewNop(), repo, bus)
+	assert.Nil(t, err)
+	consumer.retryBackoff = time.Millisecond
+	assert.Nil(t, consumer.Start())
+	defer consumer.Stop()
+
+	expected := make(map[uint][]int64)
+	for i := 0; i < perUser; i++ {
+		for userID := uint(1); userID <= numUsers; userID++ {
+			createdAt := int64(i)
+			expected[userID] = append(expected[userID], createdAt)
+
+			value, _ := json.Marshal(&models.CustomerActivity{
+				UserID:    userID,
+				CreatedAt: createdAt,
+				Action:    models.CustomAction_ViewProduct,
+			})
+			assert.Nil(t, bus.Publish(context.Background(), "product-activities", cast.ToString(userID), value, nil))
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return repo.count() == numUsers*perUser
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, expected, repo.written)
+
+	// the offset is committed once the handler returns
+	assert.Eventually(t, func() bool {
+		return consumer.Stats().TotalLag == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	stats := consumer.Stats()
+	assert.EqualValues(t, numUsers*perUser, stats.Processed)
+	assert.Len(t, stats.Partitions, 4)
+}
+
+func TestActivityConsumerReportsLagWhileStuck(t *testing.T) {
+	viper.Set("kafka.topic", "product-activities")
+	viper.Set("kafka.consumer_group", "user-activities-test")
+	defer viper.Reset()
+
+	bus := events.NewMemoryBus(zap.NewNop())
+	defer bus.Close()
+
+	consumer, err := NewActivityConsumer(zap.NewNop(), &failingRepo{}, bus)
+	assert.Nil(t, err)
+	consumer.retryBackoff = time.Millisecond
+	assert.Nil(t, consumer.Start())
+	defer consumer.Stop()
+
+	for i := 0; i < 3; i++ {
+		value, _ := json.Marshal(&models.CustomerActivity{UserID: 1, CreatedAt: int64(i), Action: models.CustomAction_ViewProduct})
+		assert.Nil(t, bus.Publish(context.Background(), "product-activities", "1", value, nil))
+	}
+
+	// no message is handled, the lag still grows with every published one
+	stats := consumer.Stats()
+	assert.EqualValues(t, 0, stats.Processed)
+	assert.EqualValues(t, 3, stats.TotalLag)
+}
+
+type failingRepo struct{}
+
+func (r *failingRepo) CreateCustomerActivity(ctx context.Context, eventID string, userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error) {
+	return nil, errors.New("database is unavailable")
+}
+
+func (r *failingRepo) CreateVisitorActivity(ctx context.Context, eventID, visitorID string, createdAt int64, action, data string) error {
+	return errors.New("database is unavailable")
+}
+
+func (r *failingRepo) NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error) {
+	return 0, errors.New("database is unavailable")
+}
+
+func (r *failingRepo) IdentifyVisitor(ctx context.Context, visitorID string, customerID uint) error {
+	return errors.New("database is unavailable")
+}
+
+func TestStoreActivityStopsWhenContextIsDone(t *testing.T) {
+	consumer, err := NewActivityConsumer(zap.NewNop(), &failingRepo{}, nil)
+	assert.Nil(t, err)
+	consumer.retryBackoff = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = consumer.storeActivity(ctx, &models.CustomerActivity{UserID: 1})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// visitorRepo keeps the activities of visitors until they are identified, like
+// the mysql repository does.
+type visitorRepo struct {
+	mu        sync.Mutex
+	customers map[string]uint
+	visitors  map[string][]int64
+	written   map[uint][]int64
+}
+
+func (r *visitorRepo) CreateCustomerActivity(ctx context.Context, eventID string, userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.written[userID] = append(r.written[userID], createdAt)
+	return &models.CustomerActivity{UserID: userID, CreatedAt: createdAt, Action: action, Data: data}, nil
+}
+
+func (r *visitorRepo) CreateVisitorActivity(ctx context.Context, eventID, visitorID string, createdAt int64, action, data string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if customerID, ok := r.customers[visitorID]; ok {
+		r.written[customerID] = append(r.written[customerID], createdAt)
+		return nil
+	}
+	r.visitors[visitorID] = append(r.visitors[visitorID], createdAt)
+	return nil
+}
+
+func (r *visitorRepo) NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error) {
+	return 0, errors.New("price drops are not supported")
+}
+
+func (r *visitorRepo) IdentifyVisitor(ctx context.Context, visitorID string, customerID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.customers[visitorID] = customerID
+	r.written[customerID] = append(r.written[customerID], r.visitors[visitorID]...)
+	delete(r.visitors, visitorID)
+	return nil
+}
+
+func (r *visitorRepo) history(customerID uint) []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]int64(nil), r.written[customerID]...)
+}
+
+func TestActivityConsumerStitchesVisitors(t *testing.T) {
+	viper.Set("kafka.topic", "product-activities")
+	viper.Set("kafka.consumer_group", "user-activities-test")
+	defer viper.Reset()
+
+	bus := events.NewMemoryBus(zap.NewNop())
+	defer bus.Close()
+
+	repo := &visitorRepo{
+		customers: make(map[string]uint),
+		visitors:  make(map[string][]int64),
+		written:   make(map[uint][]int64),
+	}
+	consumer, err := NewActivityConsumer(zap.NewNop(), repo, bus)
+	assert.Nil(t, err)
+	assert.Nil(t, consumer.Start())
+	defer consumer.Stop()
+
+	visitorID := "0123456789abcdef0123456789abcdef"
+	publish := func(activity *models.CustomerActivity) {
+		value, _ := json.Marshal(activity)
+		assert.Nil(t, bus.Publish(context.Background(), "product-activities", visitorID, value, nil))
+	}
+
+	publish(&models.CustomerActivity{VisitorID: visitorID, CreatedAt: 1, Action: models.CustomAction_ViewProduct})
+	publish(&models.CustomerActivity{VisitorID: visitorID, CreatedAt: 2, Action: models.CustomAction_SearchProduct})
+	publish(&models.CustomerActivity{UserID: 7, VisitorID: visitorID, CreatedAt: 3, Action: models.CustomAction_IdentifyVisitor})
+	// an activity still in flight when the visitor logged in
+	publish(&models.CustomerActivity{VisitorID: visitorID, CreatedAt: 4, Action: models.CustomAction_ViewProduct})
+
+	assert.Eventually(t, func() bool {
+		return len(repo.history(7)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{1, 2, 4}, repo.history(7))
+}
+
+// priceDropRepo records the price drops it is asked to notify.
+type priceDropRepo struct {
+	failingRepo
+	mu    sync.Mutex
+	drops []*models.PriceDrop
+}
+
+func (r *priceDropRepo) NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drops = append(r.drops, drop)
+	return 1, nil
+}
+
+func (r *priceDropRepo) notified() []*models.PriceDrop {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*models.PriceDrop(nil), r.drops...)
+}
+
+func TestActivityConsumerNotifiesPriceDrops(t *testing.T) {
+	viper.Set("kafka.topic", "product-activities")
+	viper.Set("kafka.consumer_group", "user-activities-test")
+	defer viper.Reset()
+
+	bus := events.NewMemoryBus(zap.NewNop())
+	defer bus.Close()
+
+	repo := &priceDropRepo{}
+	consumer, err := NewActivityConsumer(zap.NewNop(), repo, bus)
+	assert.Nil(t, err)
+	assert.Nil(t, consumer.Start())
+	defer consumer.Stop()
+
+	publish := func(data string) {
+		value, _ := json.Marshal(&models.CustomerActivity{CreatedAt: 1, Action: models.CustomAction_PriceDropped, Data: data})
+		assert.Nil(t, bus.Publish(context.Background(), "product-activities", "product-1", value, nil))
+	}
+
+	// a malformed drop is skipped, it does not block the next ones
+	publish(`{"productId":`)
+	publish(`{"productId":1,"name":"Shoes","oldPrice":250,"newPrice":200}`)
+
+	assert.Eventually(t, func() bool {
+		return len(repo.notified()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, &models.PriceDrop{ProductID: 1, Name: "Shoes", OldPrice: 250, NewPrice: 200}, repo.notified()[0])
+}
+
+func TestProjectionsRecordMetricsOfTheReplayGroup(t *testing.T) {
+	viper.Set("kafka.consumer_group", "user-activities-test")
+	defer viper.Reset()
+
+	handler := Projections(zap.NewNop(), &failingRepo{}, "user-activities-replay")[Projection_CustomerActivities]
+
+	replayed := metrics.ConsumerMessages.WithLabelValues("replayed-activities", "user-activities-replay", metrics.Result_Failure)
+	live := metrics.ConsumerMessages.WithLabelValues("replayed-activities", "user-activities-test", metrics.Result_Failure)
+	replayedBefore, liveBefore := testutil.ToFloat64(replayed), testutil.ToFloat64(live)
+
+	// a malformed message is skipped, it is only recorded as a failure
+	message := &events.Message{Topic: "replayed-activities", Value: []byte("{")}
+	assert.Nil(t, handler(context.Background(), message))
+
+	assert.Equal(t, replayedBefore+1, testutil.ToFloat64(replayed))
+	assert.Equal(t, liveBefore, testutil.ToFloat64(live))
+}
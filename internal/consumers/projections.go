@@ -0,0 +1,22 @@
+package consumers
+
+import (
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"go.uber.org/zap"
+)
+
+var (
+	Projection_CustomerActivities = "customer_activities"
+)
+
+// Projections returns, by name, the handlers able to rebuild a read model from
+// the activity topic. They are used to replay the topic with the consumer
+// group, which labels their metrics instead of the group of the consumers.
+func Projections(logger *zap.Logger, repo repository, group string) map[string]events.Handler {
+	activityConsumer, _ := NewActivityConsumer(logger, repo, nil)
+	activityConsumer.group = group
+
+	return map[string]events.Handler{
+		Projection_CustomerActivities: activityConsumer.handle,
+	}
+}
@@ -0,0 +1,90 @@
+package consumers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+)
+
+// rateWindow is the period messages per second are averaged over.
+var rateWindow = 60
+
+// ConsumerStats reports whether a consumer keeps up with its topic.
+type ConsumerStats struct {
+	Topic              string                `json:"topic"`
+	Group              string                `json:"group"`
+	Processed          uint64                `json:"processed"`
+	MessagesPerSecond  float64               `json:"messagesPerSecond"`
+	InsertLatencyAvgMs float64               `json:"insertLatencyAvgMs"`
+	InsertLatencyMaxMs float64               `json:"insertLatencyMaxMs"`
+	TotalLag           int64                 `json:"totalLag"`
+	Partitions         []events.PartitionLag `json:"partitions"`
+}
+
+// statsRecorder accumulates the statistics of the messages handled by a
+// consumer. Throughput is counted in one second buckets over rateWindow. The
+// lag is not recorded, it would go stale as soon as the consumer is stuck.
+type statsRecorder struct {
+	mu            sync.Mutex
+	processed     uint64
+	latencyTotal  time.Duration
+	latencyMax    time.Duration
+	buckets       []uint64
+	bucketSeconds []int64
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{
+		buckets:       make([]uint64, rateWindow),
+		bucketSeconds: make([]int64, rateWindow),
+	}
+}
+
+func (r *statsRecorder) record(insertLatency time.Duration, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.processed++
+	r.latencyTotal += insertLatency
+	if insertLatency > r.latencyMax {
+		r.latencyMax = insertLatency
+	}
+
+	second := now.Unix()
+	bucket := second % int64(rateWindow)
+	if r.bucketSeconds[bucket] != second {
+		r.bucketSeconds[bucket] = second
+		r.buckets[bucket] = 0
+	}
+	r.buckets[bucket]++
+}
+
+func (r *statsRecorder) snapshot(now time.Time) ConsumerStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := ConsumerStats{
+		Processed:          r.processed,
+		InsertLatencyMaxMs: milliseconds(r.latencyMax),
+		Partitions:         []events.PartitionLag{},
+	}
+	if r.processed > 0 {
+		stats.InsertLatencyAvgMs = milliseconds(r.latencyTotal / time.Duration(r.processed))
+	}
+
+	var recent uint64
+	oldest := now.Unix() - int64(rateWindow)
+	for i, second := range r.bucketSeconds {
+		if second > oldest {
+			recent += r.buckets[i]
+		}
+	}
+	stats.MessagesPerSecond = float64(recent) / float64(rateWindow)
+
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown event bus driver")
+	ErrBufferFull    = errors.New("event bus buffer is full")
+	ErrClosed        = errors.New("event bus is closed")
+	ErrNotMember     = errors.New("subscription is not a member of its consumer group")
+	ErrNotShareable  = errors.New("the memory event bus only works when publisher and subscriber run in the same process")
+)
+
+var (
+	DriverKafka  = "kafka"
+	DriverMemory = "memory"
+)
+
+// Message is an event delivered to a Handler. HighWaterMark is the offset the
+// next message of the partition will get, the consumer lag once the message is
+// handled is HighWaterMark - Offset - 1. Headers carry the trace context of the
+// publisher.
+type Message struct {
+	Topic         string
+	Key           string
+	Value         []byte
+	Headers       map[string]string
+	Partition     int32
+	Offset        int64
+	HighWaterMark int64
+	Timestamp     time.Time
+}
+
+// PartitionLag is the position of a consumer group in a partition.
+type PartitionLag struct {
+	Partition     int32 `json:"partition"`
+	Committed     int64 `json:"committed"`
+	HighWaterMark int64 `json:"highWaterMark"`
+	Lag           int64 `json:"lag"`
+}
+
+// Handler processes one message. Messages of a partition are handed over one
+// at a time in the order they were published. Returning an error leaves the
+// message unacknowledged so it is delivered again, handlers should therefore
+// only fail when ctx is done and retry transient errors themselves.
+type Handler func(ctx context.Context, message *Message) error
+
+// Publisher publishes messages without waiting for them to be delivered.
+// Messages with the same key keep their order. done is called exactly once
+// with the delivery result unless Publish returns an error. The trace context
+// of ctx is sent along with the message.
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, value []byte, done func(error)) error
+	// Flush waits for every published message to be delivered or failed.
+	Flush(ctx context.Context) error
+	// Check reports whether messages can currently be delivered.
+	Check(ctx context.Context) error
+	Close() error
+}
+
+// Subscriber consumes a topic as a member of a consumer group, every group
+// receives every message of the topic.
+type Subscriber interface {
+	// Subscribe returns once the subscription is ready to receive messages.
+	Subscribe(topic, group string, handler Handler) (Subscription, error)
+}
+
+type Subscription interface {
+	// Check reports whether the subscription currently takes part in its
+	// consumer group.
+	Check(ctx context.Context) error
+	// Lag reports, for every partition, how far the offset committed by the
+	// group is behind the high-water mark at the time of the call.
+	Lag() ([]PartitionLag, error)
+	// Close stops the subscription and waits for the handler to return.
+	Close() error
+}
+
+// New creates the publisher and subscriber of the driver configured in
+// eventbus.driver, kafka is used when it is not set.
+func New(logger *zap.Logger) (Publisher, Subscriber, error) {
+	switch driver := viper.GetString("eventbus.driver"); driver {
+	case "", DriverKafka:
+		publisher, err := NewKafkaPublisher(logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return publisher, NewKafkaSubscriber(logger), nil
+	case DriverMemory:
+		bus := NewMemoryBus(logger)
+		return bus, bus, nil
+	default:
+		logger.Error("Event bus driver is unknown", zap.String("driver", driver))
+		return nil, nil, ErrUnknownDriver
+	}
+}
+
+// NewPublisher creates the publisher of the configured driver for a process
+// which does not subscribe. The memory driver is rejected, nobody could
+// receive its messages.
+func NewPublisher(logger *zap.Logger) (Publisher, error) {
+	switch driver := viper.GetString("eventbus.driver"); driver {
+	case "", DriverKafka:
+		return NewKafkaPublisher(logger)
+	case DriverMemory:
+		return nil, ErrNotShareable
+	default:
+		logger.Error("Event bus driver is unknown", zap.String("driver", driver))
+		return nil, ErrUnknownDriver
+	}
+}
+
+// NewSubscriber creates the subscriber of the configured driver for a process
+// which does not publish. The memory driver is rejected, nothing could
+// publish to it.
+func NewSubscriber(logger *zap.Logger) (Subscriber, error) {
+	switch driver := viper.GetString("eventbus.driver"); driver {
+	case "", DriverKafka:
+		return NewKafkaSubscriber(logger), nil
+	case DriverMemory:
+		return nil, ErrNotShareable
+	default:
+		logger.Error("Event bus driver is unknown", zap.String("driver", driver))
+		return nil, ErrUnknownDriver
+	}
+}
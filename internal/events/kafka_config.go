@@ -0,0 +1,228 @@
+package events
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+	"github.com/xdg-go/scram"
+)
+
+var (
+	ErrNoKafkaBrokers       = errors.New("kafka.brokers is empty")
+	ErrInvalidSASLMechanism = errors.New("kafka.sasl.mechanism must be one of PLAIN, SCRAM-SHA-256, SCRAM-SHA-512")
+	ErrMissingSASLUser      = errors.New("kafka.sasl.username and kafka.sasl.password are required when sasl is enabled")
+	ErrInvalidCompression   = errors.New("kafka.producer.compression must be one of none, gzip, snappy, lz4, zstd")
+	ErrInvalidHeartbeat     = errors.New("kafka.consumer.heartbeat_interval must be lower than a third of kafka.consumer.session_timeout")
+)
+
+var (
+	defaultKafkaClientID = "ecommerce-demo"
+	defaultKafkaVersion  = sarama.V1_0_0_0
+)
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// ValidateKafkaConfig checks the [kafka] section, it is meant to be called at
+// startup so a bad configuration fails fast instead of on first use.
+func ValidateKafkaConfig() error {
+	if len(viper.GetStringSlice("kafka.brokers")) == 0 {
+		return ErrNoKafkaBrokers
+	}
+
+	config, err := newKafkaConfig()
+	if err != nil {
+		return err
+	}
+	if err := setProducerConfig(config, defaultBufferSize); err != nil {
+		return err
+	}
+
+	return config.Validate()
+}
+
+// newKafkaConfig returns the sarama configuration shared by producers and
+// consumers, built from the [kafka] section.
+func newKafkaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+
+	config.ClientID = viper.GetString("kafka.client_id")
+	if config.ClientID == "" {
+		config.ClientID = defaultKafkaClientID
+	}
+
+	config.Version = defaultKafkaVersion
+	if version := viper.GetString("kafka.version"); version != "" {
+		parsed, err := sarama.ParseKafkaVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.version: %w", err)
+		}
+		config.Version = parsed
+	}
+
+	if viper.GetBool("kafka.tls.enabled") {
+		tlsConfig, err := newTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if viper.GetBool("kafka.sasl.enabled") {
+		if err := setSASLConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if timeout := viper.GetDuration("kafka.consumer.session_timeout"); timeout > 0 {
+		config.Consumer.Group.Session.Timeout = timeout
+	}
+	if interval := viper.GetDuration("kafka.consumer.heartbeat_interval"); interval > 0 {
+		config.Consumer.Group.Heartbeat.Interval = interval
+	}
+	if config.Consumer.Group.Heartbeat.Interval*3 > config.Consumer.Group.Session.Timeout {
+		return nil, ErrInvalidHeartbeat
+	}
+
+	return config, nil
+}
+
+// setProducerConfig applies the [kafka.producer] section.
+func setProducerConfig(config *sarama.Config, bufferSize int) error {
+	flushFrequency := viper.GetDuration("kafka.producer.flush_frequency")
+	if flushFrequency <= 0 {
+		flushFrequency = defaultFlushFrequency
+	}
+	flushMessages := viper.GetInt("kafka.producer.flush_messages")
+	if flushMessages <= 0 {
+		flushMessages = defaultFlushMessages
+	}
+
+	compression := sarama.CompressionSnappy
+	if name := viper.GetString("kafka.producer.compression"); name != "" {
+		codec, ok := compressionCodecs[strings.ToLower(name)]
+		if !ok {
+			return ErrInvalidCompression
+		}
+		compression = codec
+	}
+
+	config.ChannelBufferSize = bufferSize
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	// the idempotent producer keeps retried batches in order within a
+	// partition, which requires a single in-flight request per broker
+	config.Producer.Idempotent = true
+	config.Net.MaxOpenRequests = 1
+	config.Producer.Compression = compression
+	config.Producer.Flush.Frequency = flushFrequency
+	config.Producer.Flush.Messages = flushMessages
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	if viper.IsSet("kafka.producer.retry_max") {
+		config.Producer.Retry.Max = viper.GetInt("kafka.producer.retry_max")
+	}
+	if backoff := viper.GetDuration("kafka.producer.retry_backoff"); backoff > 0 {
+		config.Producer.Retry.Backoff = backoff
+	}
+
+	return nil
+}
+
+func newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: viper.GetBool("kafka.tls.insecure_skip_verify"),
+	}
+
+	if caFile := viper.GetString("kafka.tls.ca_file"); caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.tls.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("kafka.tls.ca_file: no certificate found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := viper.GetString("kafka.tls.cert_file"), viper.GetString("kafka.tls.key_file")
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.tls.cert_file/key_file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func setSASLConfig(config *sarama.Config) error {
+	user, password := viper.GetString("kafka.sasl.username"), viper.GetString("kafka.sasl.password")
+	if user == "" || password == "" {
+		return ErrMissingSASLUser
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = user
+	config.Net.SASL.Password = password
+
+	switch mechanism := strings.ToUpper(viper.GetString("kafka.sasl.mechanism")); mechanism {
+	case "", sarama.SASLTypePlaintext:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha256.New}
+		}
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{HashGeneratorFcn: sha512.New}
+		}
+	default:
+		return ErrInvalidSASLMechanism
+	}
+
+	return nil
+}
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram.
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.Client = client
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
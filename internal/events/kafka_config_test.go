@@ -0,0 +1,82 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKafkaConfig(t *testing.T) {
+	tests := map[string]struct {
+		settings      map[string]interface{}
+		expectedError error
+	}{
+		"defaults": {
+			settings:      map[string]interface{}{},
+			expectedError: nil,
+		},
+		"no brokers": {
+			settings:      map[string]interface{}{"kafka.brokers": []string{}},
+			expectedError: events.ErrNoKafkaBrokers,
+		},
+		"scram": {
+			settings: map[string]interface{}{
+				"kafka.sasl.enabled":   true,
+				"kafka.sasl.mechanism": "SCRAM-SHA-512",
+				"kafka.sasl.username":  "user",
+				"kafka.sasl.password":  "secret",
+			},
+			expectedError: nil,
+		},
+		"unknown sasl mechanism": {
+			settings: map[string]interface{}{
+				"kafka.sasl.enabled":   true,
+				"kafka.sasl.mechanism": "GSSAPI",
+				"kafka.sasl.username":  "user",
+				"kafka.sasl.password":  "secret",
+			},
+			expectedError: events.ErrInvalidSASLMechanism,
+		},
+		"sasl without credentials": {
+			settings:      map[string]interface{}{"kafka.sasl.enabled": true},
+			expectedError: events.ErrMissingSASLUser,
+		},
+		"unknown compression": {
+			settings:      map[string]interface{}{"kafka.producer.compression": "brotli"},
+			expectedError: events.ErrInvalidCompression,
+		},
+		"heartbeat too close to session timeout": {
+			settings: map[string]interface{}{
+				"kafka.consumer.session_timeout":    "6s",
+				"kafka.consumer.heartbeat_interval": "3s",
+			},
+			expectedError: events.ErrInvalidHeartbeat,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+
+			viper.Set("kafka.brokers", []string{"127.0.0.1:9092"})
+			for key, value := range test.settings {
+				viper.Set(key, value)
+			}
+
+			assert.ErrorIs(t, events.ValidateKafkaConfig(), test.expectedError)
+		})
+	}
+}
+
+func TestValidateKafkaConfigRejectsUnknownVersion(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("kafka.brokers", []string{"127.0.0.1:9092"})
+	viper.Set("kafka.version", "not-a-version")
+
+	assert.NotNil(t, events.ValidateKafkaConfig())
+}
@@ -0,0 +1,180 @@
+package events
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+)
+
+var (
+	defaultLagTimeout  = 5 * time.Second
+	defaultLagCacheTTL = 5 * time.Second
+)
+
+// KafkaGroupLag returns, for every partition of the topic, how far the
+// committed offset of the consumer group is behind the high-water mark. A
+// partition without committed offset is reported as committed at -1 and
+// lagging by its high-water mark.
+func KafkaGroupLag(topic, group string) ([]PartitionLag, error) {
+	client, admin, err := newLagClient()
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	return groupLag(client, admin, topic, group)
+}
+
+// newLagClient connects the client and the admin reading the lag. Every
+// network call and metadata request is bounded by kafka.lag.timeout, so a slow
+// broker fails the lag report instead of hanging it. Closing the admin closes
+// the client.
+func newLagClient() (sarama.Client, sarama.ClusterAdmin, error) {
+	config, err := newKafkaConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timeout := viper.GetDuration("kafka.lag.timeout")
+	if timeout <= 0 {
+		timeout = defaultLagTimeout
+	}
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	config.Metadata.Timeout = timeout
+	config.Admin.Timeout = timeout
+
+	client, err := sarama.NewClient(viper.GetStringSlice("kafka.brokers"), config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	return client, admin, nil
+}
+
+func groupLag(client sarama.Client, admin sarama.ClusterAdmin, topic, group string) ([]PartitionLag, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]PartitionLag, 0, len(partitions))
+	for _, partition := range partitions {
+		highWaterMark, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		committed := int64(-1)
+		if block := offsets.GetBlock(topic, partition); block != nil {
+			committed = block.Offset
+		}
+
+		lag := highWaterMark
+		if committed >= 0 {
+			lag = highWaterMark - committed
+		}
+
+		lags = append(lags, PartitionLag{
+			Partition:     partition,
+			Committed:     committed,
+			HighWaterMark: highWaterMark,
+			Lag:           lag,
+		})
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		return lags[i].Partition < lags[j].Partition
+	})
+
+	return lags, nil
+}
+
+// kafkaLag reads the lag of a consumer group with one client kept for the
+// life of the subscription. A report is reused for kafka.lag.cache_ttl, so
+// frequent polling of the consumer status does not query the brokers on every
+// call.
+type kafkaLag struct {
+	topic string
+	group string
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+	lags   []PartitionLag
+	readAt time.Time
+}
+
+func newKafkaLag(topic, group string) *kafkaLag {
+	ttl := viper.GetDuration("kafka.lag.cache_ttl")
+	if ttl <= 0 {
+		ttl = defaultLagCacheTTL
+	}
+
+	return &kafkaLag{
+		topic: topic,
+		group: group,
+		ttl:   ttl,
+	}
+}
+
+// Lag returns the last report while it is fresh, or reads a new one. The
+// client is connected on the first call, and again after a failed one.
+func (l *kafkaLag) Lag() ([]PartitionLag, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lags != nil && time.Since(l.readAt) < l.ttl {
+		return l.lags, nil
+	}
+
+	if l.admin == nil {
+		client, admin, err := newLagClient()
+		if err != nil {
+			return nil, err
+		}
+		l.client, l.admin = client, admin
+	}
+
+	lags, err := groupLag(l.client, l.admin, l.topic, l.group)
+	if err != nil {
+		l.closeClient()
+		return nil, err
+	}
+
+	l.lags, l.readAt = lags, time.Now()
+	return lags, nil
+}
+
+func (l *kafkaLag) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.closeClient()
+}
+
+func (l *kafkaLag) closeClient() error {
+	if l.admin == nil {
+		return nil
+	}
+
+	err := l.admin.Close()
+	l.client, l.admin = nil, nil
+	return err
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaLagReusesFreshReports(t *testing.T) {
+	viper.Set("kafka.brokers", []string{"127.0.0.1:1"})
+	viper.Set("kafka.lag.timeout", "100ms")
+	defer viper.Reset()
+
+	lag := newKafkaLag("product-activities", "user-activities-test")
+	defer lag.Close()
+
+	// a fresh report is answered without reaching the brokers
+	lag.lags = []PartitionLag{{Partition: 0, Committed: 7, HighWaterMark: 10, Lag: 3}}
+	lag.readAt = time.Now()
+	lags, err := lag.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, lag.lags, lags)
+
+	// a stale one is read again, which fails without brokers
+	lag.readAt = time.Now().Add(-time.Minute)
+	_, err = lag.Lag()
+	assert.NotNil(t, err)
+}
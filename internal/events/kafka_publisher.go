@@ -0,0 +1,259 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/viper"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	defaultBufferSize     = 1024
+	defaultFlushFrequency = 100 * time.Millisecond
+	defaultFlushMessages  = 100
+)
+
+// ProducerStats is a snapshot of the message counters of a KafkaPublisher.
+type ProducerStats struct {
+	Enqueued  uint64
+	Succeeded uint64
+	Failed    uint64
+	Rejected  uint64
+}
+
+// envelope travels with the message as sarama metadata, so the result can be
+// reported back to the publisher once the broker acknowledged it.
+type envelope struct {
+	done func(error)
+	span trace.Span
+}
+
+// KafkaPublisher publishes messages with a sarama.AsyncProducer.
+// Messages are batched and compressed by sarama, the number of messages
+// waiting for an acknowledgement is bounded by the buffer size.
+type KafkaPublisher struct {
+	logger   *zap.Logger
+	client   sarama.Client
+	producer sarama.AsyncProducer
+	buffer   chan struct{}
+	inflight sync.WaitGroup
+	drained  sync.WaitGroup
+	mu       sync.RWMutex
+	closed   bool
+
+	enqueued  uint64
+	succeeded uint64
+	failed    uint64
+	rejected  uint64
+}
+
+func NewKafkaPublisher(logger *zap.Logger) (*KafkaPublisher, error) {
+	bufferSize := viper.GetInt("kafka.producer.buffer_size")
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+
+	client, producer, err := initProducer(logger, viper.GetStringSlice("kafka.brokers"), bufferSize)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &KafkaPublisher{
+		logger:   logger,
+		client:   client,
+		producer: producer,
+		buffer:   make(chan struct{}, bufferSize),
+	}
+
+	p.drained.Add(2)
+	go p.drainSuccesses()
+	go p.drainErrors()
+
+	return p, nil
+}
+
+// Publish enqueues the message without waiting for the broker. Messages with
+// the same key are written to the same partition in the order they were
+// published. done is called from a goroutine owned by the publisher.
+// ErrBufferFull is returned when too many messages are waiting for an
+// acknowledgement.
+func (p *KafkaPublisher) Publish(ctx context.Context, topic, key string, value []byte, done func(error)) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	span, headers := startPublishSpan(ctx, topic, key)
+
+	if p.closed {
+		tracing.End(span, ErrClosed)
+		return ErrClosed
+	}
+
+	select {
+	case p.buffer <- struct{}{}:
+	default:
+		atomic.AddUint64(&p.rejected, 1)
+		tracing.End(span, ErrBufferFull)
+		return ErrBufferFull
+	}
+
+	p.inflight.Add(1)
+	atomic.AddUint64(&p.enqueued, 1)
+	message := &sarama.ProducerMessage{
+		Topic:    topic,
+		Value:    sarama.ByteEncoder(value),
+		Headers:  toRecordHeaders(headers),
+		Metadata: &envelope{done: done, span: span},
+	}
+	if key != "" {
+		message.Key = sarama.StringEncoder(key)
+	}
+	p.producer.Input() <- message
+
+	return nil
+}
+
+// Flush waits until every enqueued message has been acknowledged or failed, or
+// until ctx is done.
+func (p *KafkaPublisher) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, waits for the in-flight ones to be delivered
+// and shuts the underlying producer down.
+func (p *KafkaPublisher) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.producer.AsyncClose()
+	p.drained.Wait()
+	if err := p.client.Close(); err != nil {
+		return err
+	}
+
+	stats := p.Stats()
+	p.logger.Info("Closed kafka producer",
+		zap.Uint64("enqueued", stats.Enqueued),
+		zap.Uint64("succeeded", stats.Succeeded),
+		zap.Uint64("failed", stats.Failed),
+		zap.Uint64("rejected", stats.Rejected))
+
+	return nil
+}
+
+// Check refreshes the cluster metadata, which fails when no broker can be
+// reached.
+func (p *KafkaPublisher) Check(ctx context.Context) error {
+	if p.client.Closed() {
+		return ErrClosed
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- p.client.RefreshMetadata()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *KafkaPublisher) Stats() ProducerStats {
+	return ProducerStats{
+		Enqueued:  atomic.LoadUint64(&p.enqueued),
+		Succeeded: atomic.LoadUint64(&p.succeeded),
+		Failed:    atomic.LoadUint64(&p.failed),
+		Rejected:  atomic.LoadUint64(&p.rejected),
+	}
+}
+
+func (p *KafkaPublisher) drainSuccesses() {
+	defer p.drained.Done()
+
+	for message := range p.producer.Successes() {
+		atomic.AddUint64(&p.succeeded, 1)
+		p.logger.Debug("Produced message to kafka",
+			zap.String("topic", message.Topic),
+			zap.Int32("partition", message.Partition),
+			zap.Int64("offset", message.Offset))
+		p.complete(message, nil)
+	}
+}
+
+func (p *KafkaPublisher) drainErrors() {
+	defer p.drained.Done()
+
+	for producerErr := range p.producer.Errors() {
+		atomic.AddUint64(&p.failed, 1)
+		p.logger.Error("Produced message to kafka failed",
+			zap.Error(producerErr.Err),
+			zap.String("topic", producerErr.Msg.Topic))
+		p.complete(producerErr.Msg, producerErr.Err)
+	}
+}
+
+func (p *KafkaPublisher) complete(message *sarama.ProducerMessage, err error) {
+	if env, ok := message.Metadata.(*envelope); ok {
+		if env.span != nil {
+			env.span.SetAttributes(semconv.MessagingKafkaPartitionKey.Int64(int64(message.Partition)))
+			tracing.End(env.span, err)
+		}
+		if env.done != nil {
+			env.done(err)
+		}
+	}
+	<-p.buffer
+	p.inflight.Done()
+}
+
+func initProducer(logger *zap.Logger, brokers []string, bufferSize int) (sarama.Client, sarama.AsyncProducer, error) {
+	logger.Info("Creating kafka producer...")
+
+	config, err := newKafkaConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := setProducerConfig(config, bufferSize); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	logger.Info("Successfully created kafka producer")
+
+	return client, producer, nil
+}
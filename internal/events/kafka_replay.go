@@ -0,0 +1,235 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ReplayOptions selects what ReplayKafka re-consumes. FromTime takes precedence
+// over FromOffset when it is set, the topic is replayed from its oldest
+// message when neither is set.
+type ReplayOptions struct {
+	Topic      string
+	Group      string
+	FromOffset int64
+	FromTime   time.Time
+}
+
+// ReplayProgress reports the position of a partition during a replay.
+type ReplayProgress struct {
+	Partition int32
+	Offset    int64
+	End       int64
+	Handled   uint64
+}
+
+// ReplayKafka re-consumes the topic as a member of opts.Group, from the
+// requested position up to the end of every partition at the time the replay
+// started. progress is called after every handled message, possibly from
+// several goroutines. The number of handled messages is returned.
+func ReplayKafka(ctx context.Context, logger *zap.Logger, opts ReplayOptions, handler Handler, progress func(ReplayProgress)) (uint64, error) {
+	config, err := newKafkaConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	client, err := sarama.NewClient(viper.GetStringSlice("kafka.brokers"), config)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	partitions, err := client.Partitions(opts.Topic)
+	if err != nil {
+		return 0, err
+	}
+
+	replay := &replayHandler{
+		logger:   logger,
+		handler:  handler,
+		progress: progress,
+		start:    make(map[int32]int64),
+		end:      make(map[int32]int64),
+		pending:  make(map[int32]bool),
+		reset:    make(map[int32]bool),
+	}
+	for _, partition := range partitions {
+		end, err := client.GetOffset(opts.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return 0, err
+		}
+
+		start, err := replayStart(client, opts, partition)
+		if err != nil {
+			return 0, err
+		}
+		if start < 0 || start > end {
+			start = end
+		}
+
+		replay.start[partition] = start
+		replay.end[partition] = end
+		if start < end {
+			replay.pending[partition] = true
+		}
+
+		logger.Info("Replaying partition",
+			zap.String("topic", opts.Topic),
+			zap.Int32("partition", partition),
+			zap.Int64("start", start),
+			zap.Int64("end", end))
+	}
+	if len(replay.pending) == 0 {
+		return 0, nil
+	}
+
+	group, err := sarama.NewConsumerGroupFromClient(opts.Group, client)
+	if err != nil {
+		return 0, err
+	}
+	defer group.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replay.cancelFn = cancel
+
+	for ctx.Err() == nil {
+		if err := group.Consume(ctx, []string{opts.Topic}, replay); err != nil {
+			logger.Error("Error from replay consumer", zap.Error(err))
+			return replay.handledCount(), err
+		}
+	}
+
+	if replay.remaining() > 0 {
+		return replay.handledCount(), ctx.Err()
+	}
+	return replay.handledCount(), nil
+}
+
+func replayStart(client sarama.Client, opts ReplayOptions, partition int32) (int64, error) {
+	if !opts.FromTime.IsZero() {
+		return client.GetOffset(opts.Topic, partition, opts.FromTime.UnixMilli())
+	}
+	if opts.FromOffset >= 0 {
+		return opts.FromOffset, nil
+	}
+	return client.GetOffset(opts.Topic, partition, sarama.OffsetOldest)
+}
+
+type replayHandler struct {
+	logger   *zap.Logger
+	handler  Handler
+	progress func(ReplayProgress)
+	cancelFn context.CancelFunc
+
+	start   map[int32]int64
+	end     map[int32]int64
+	mu      sync.Mutex
+	pending map[int32]bool
+	reset   map[int32]bool
+	handled uint64
+}
+
+// Setup moves a partition to its replay start the first time it is claimed,
+// regardless of what the group committed before. When the partition is claimed
+// again after an error or a rebalance, the replay resumes from the offset
+// committed since, so no message is handled twice.
+func (r *replayHandler) Setup(session sarama.ConsumerGroupSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			if r.reset[partition] {
+				continue
+			}
+			session.ResetOffset(topic, partition, r.start[partition], "")
+			r.reset[partition] = true
+		}
+	}
+	return nil
+}
+
+func (r *replayHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (r *replayHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	end := r.end[claim.Partition()]
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if message.Offset >= end {
+				// written after the replay started
+				r.done(claim.Partition())
+				return nil
+			}
+
+			if err := r.handler(session.Context(), &Message{
+				Topic:         message.Topic,
+				Key:           string(message.Key),
+				Value:         message.Value,
+				Headers:       fromRecordHeaders(message.Headers),
+				Partition:     message.Partition,
+				Offset:        message.Offset,
+				HighWaterMark: claim.HighWaterMarkOffset(),
+				Timestamp:     message.Timestamp,
+			}); err != nil {
+				return err
+			}
+			session.MarkMessage(message, "")
+
+			r.mu.Lock()
+			r.handled++
+			handled := r.handled
+			r.mu.Unlock()
+			if r.progress != nil {
+				r.progress(ReplayProgress{
+					Partition: message.Partition,
+					Offset:    message.Offset,
+					End:       end,
+					Handled:   handled,
+				})
+			}
+
+			if message.Offset+1 >= end {
+				r.done(claim.Partition())
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// done marks the partition as replayed and stops the replay once every
+// partition is.
+func (r *replayHandler) done(partition int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pending, partition)
+	if len(r.pending) == 0 {
+		r.cancelFn()
+	}
+}
+
+func (r *replayHandler) remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func (r *replayHandler) handledCount() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.handled
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReplaySetupResetsPartitionsOnlyOnce(t *testing.T) {
+	replay := &replayHandler{
+		logger:  zap.NewNop(),
+		start:   map[int32]int64{0: 5, 1: 7},
+		end:     map[int32]int64{0: 10, 1: 10},
+		pending: map[int32]bool{0: true, 1: true},
+		reset:   make(map[int32]bool),
+	}
+
+	// the first session claims partition 0 only
+	first := &fakeSession{
+		ctx:    context.Background(),
+		claims: map[string][]int32{"product-activities": {0}},
+		resets: make(map[int32]int64),
+	}
+	assert.Nil(t, replay.Setup(first))
+	assert.Equal(t, map[int32]int64{0: 5}, first.resets)
+
+	// after a rebalance partition 0 resumes from its committed offset and
+	// partition 1 is claimed for the first time
+	second := &fakeSession{
+		ctx:    context.Background(),
+		claims: map[string][]int32{"product-activities": {0, 1}},
+		resets: make(map[int32]int64),
+	}
+	assert.Nil(t, replay.Setup(second))
+	assert.Equal(t, map[int32]int64{1: 7}, second.resets)
+}
@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// KafkaSubscriber subscribes to kafka topics, every subscription runs its own
+// sarama.ConsumerGroup.
+type KafkaSubscriber struct {
+	logger *zap.Logger
+}
+
+func NewKafkaSubscriber(logger *zap.Logger) *KafkaSubscriber {
+	return &KafkaSubscriber{
+		logger: logger,
+	}
+}
+
+func (s *KafkaSubscriber) Subscribe(topic, group string, handler Handler) (Subscription, error) {
+	client, err := initConsumer(s.logger, viper.GetStringSlice("kafka.brokers"), group)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription := &kafkaSubscription{
+		logger:   s.logger,
+		client:   client,
+		group:    group,
+		lag:      newKafkaLag(topic, group),
+		handler:  handler,
+		ready:    make(chan bool),
+		ctx:      ctx,
+		cancelFn: cancel,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(subscription.done)
+		for {
+			// `Consume` should be called inside an infinite loop, when a
+			// server-side rebalance happens, the consumer session will need to be
+			// recreated to get the new claims
+			if err := client.Consume(ctx, []string{topic}, &consumerHandler{s: subscription}); err != nil {
+				s.logger.Error("Error from consumer", zap.Error(err))
+			}
+			// check if context was cancelled, signaling that the consumer should stop
+			if ctx.Err() != nil {
+				return
+			}
+			subscription.ready = make(chan bool)
+		}
+	}()
+
+	<-subscription.ready
+
+	return subscription, nil
+}
+
+type kafkaSubscription struct {
+	logger   *zap.Logger
+	client   sarama.ConsumerGroup
+	group    string
+	lag      *kafkaLag
+	handler  Handler
+	ready    chan bool
+	ctx      context.Context
+	cancelFn context.CancelFunc
+	done     chan struct{}
+	member   int32
+}
+
+// Check fails between sessions, while the group rebalances or the consumer
+// cannot reach the coordinator.
+func (s *kafkaSubscription) Check(ctx context.Context) error {
+	if atomic.LoadInt32(&s.member) == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// Lag reads the offsets the group committed to kafka, so it is accurate even
+// when no message is handled.
+func (s *kafkaSubscription) Lag() ([]PartitionLag, error) {
+	return s.lag.Lag()
+}
+
+func (s *kafkaSubscription) Close() error {
+	s.cancelFn()
+	<-s.done
+	if err := s.lag.Close(); err != nil {
+		s.logger.Warn("Close kafka lag client failed", zap.Error(err))
+	}
+	return s.client.Close()
+}
+
+type consumerHandler struct {
+	s *kafkaSubscription
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (handler *consumerHandler) Setup(sarama.ConsumerGroupSession) error {
+	atomic.StoreInt32(&handler.s.member, 1)
+	// Mark the consumer as ready
+	close(handler.s.ready)
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited
+func (handler *consumerHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	atomic.StoreInt32(&handler.s.member, 0)
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupClaim's Messages().
+func (handler *consumerHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	// NOTE:
+	// Do not move the code below to a goroutine.
+	// The `ConsumeClaim` itself is called within a goroutine, see:
+	// https://github.com/Shopify/sarama/blob/main/consumer_group.go#L27-L29
+	//
+	// Messages of a claim are handed to the handler one by one, which keeps
+	// messages with the same key in the order they were produced.
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			handler.s.logger.Debug("Message claimed",
+				zap.Time("timestamp", message.Timestamp),
+				zap.String("topic", message.Topic),
+				zap.Int32("partition", message.Partition),
+				zap.Int64("offset", message.Offset))
+
+			msg := &Message{
+				Topic:         message.Topic,
+				Key:           string(message.Key),
+				Value:         message.Value,
+				Headers:       fromRecordHeaders(message.Headers),
+				Partition:     message.Partition,
+				Offset:        message.Offset,
+				HighWaterMark: claim.HighWaterMarkOffset(),
+				Timestamp:     message.Timestamp,
+			}
+
+			// the trace of the publisher continues in the handler
+			ctx, span := startConsumeSpan(session.Context(), handler.s.group, msg)
+			err := handler.s.handler(ctx, msg)
+			tracing.End(span, err)
+			if err != nil {
+				// the message is redelivered to whoever claims the partition
+				// in the next session
+				handler.s.logger.Warn("Handle message failed",
+					zap.Error(err),
+					zap.String("topic", message.Topic),
+					zap.Int32("partition", message.Partition),
+					zap.Int64("offset", message.Offset))
+				return nil
+			}
+
+			session.MarkMessage(message, "")
+
+		// Should return when `session.Context()` is done.
+		// If not, will r`aise `ErrRebalanceInProgress` or `read tcp <ip>:<port>: i/o timeout` when kafka rebalance. see:
+		// https://github.com/Shopify/sarama/issues/1192
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+func initConsumer(logger *zap.Logger, brokers []string, group string) (sarama.ConsumerGroup, error) {
+	logger.Info("Creating kafka consumer...", zap.String("group", group))
+
+	cfg, err := newKafkaConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+
+	consumerGroup, err := sarama.NewConsumerGroup(brokers, group, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Successfully created kafka consumer", zap.String("group", group))
+
+	return consumerGroup, nil
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeSession struct {
+	ctx    context.Context
+	claims map[string][]int32
+	mu     sync.Mutex
+	marked map[int32]int64
+	resets map[int32]int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32                                              { return s.claims }
+func (s *fakeSession) MemberID() string                                                        { return "" }
+func (s *fakeSession) GenerationID() int32                                                     { return 0 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {}
+func (s *fakeSession) Commit()                                                                 {}
+func (s *fakeSession) Context() context.Context                                                { return s.ctx }
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resets[partition] = offset
+}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked[msg.Partition] = msg.Offset + 1
+}
+
+type fakeClaim struct {
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "product-activities" }
+func (c *fakeClaim) Partition() int32                         { return c.partition }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(len(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestConsumeClaimKeepsPerKeyOrder(t *testing.T) {
+	const (
+		topic         = "product-activities"
+		numPartitions = 4
+		numKeys       = 8
+		perKey        = 25
+	)
+
+	// partition the messages the way the publisher does, by hashing the key
+	partitioner := sarama.NewHashPartitioner(topic)
+	claims := make([]*fakeClaim, numPartitions)
+	for i := range claims {
+		claims[i] = &fakeClaim{
+			partition: int32(i),
+			messages:  make(chan *sarama.ConsumerMessage, numKeys*perKey),
+		}
+	}
+
+	expected := make(map[string][]string)
+	sent := make(map[int32]int64)
+	for i := 0; i < perKey; i++ {
+		for k := 1; k <= numKeys; k++ {
+			key, value := cast.ToString(k), cast.ToString(i)
+			expected[key] = append(expected[key], value)
+
+			partition, err := partitioner.Partition(&sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(key)}, numPartitions)
+			assert.Nil(t, err)
+
+			claims[partition].messages <- &sarama.ConsumerMessage{
+				Topic:     topic,
+				Partition: partition,
+				Offset:    sent[partition],
+				Key:       []byte(key),
+				Value:     []byte(value),
+			}
+			sent[partition]++
+		}
+	}
+	assert.Greater(t, len(sent), 1, "keys should be spread over several partitions")
+
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	subscription := &kafkaSubscription{
+		logger: zap.NewNop(),
+		handler: func(ctx context.Context, message *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[message.Key] = append(received[message.Key], string(message.Value))
+			return nil
+		},
+	}
+	session := &fakeSession{ctx: context.Background(), marked: make(map[int32]int64)}
+	handler := &consumerHandler{s: subscription}
+
+	// partitions are consumed concurrently, like sarama does for a session
+	var wg sync.WaitGroup
+	for _, claim := range claims {
+		close(claim.messages)
+		wg.Add(1)
+		go func(claim *fakeClaim) {
+			defer wg.Done()
+			assert.Nil(t, handler.ConsumeClaim(session, claim))
+		}(claim)
+	}
+	wg.Wait()
+
+	assert.Equal(t, expected, received)
+	// every message has been marked, so the committed offsets reach the end
+	// of each partition
+	assert.Equal(t, sent, session.marked)
+}
+
+func TestConsumeClaimStopsAtFailedMessage(t *testing.T) {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	for offset := int64(0); offset < 3; offset++ {
+		claim.messages <- &sarama.ConsumerMessage{Offset: offset}
+	}
+	close(claim.messages)
+
+	var handled []int64
+	subscription := &kafkaSubscription{
+		logger: zap.NewNop(),
+		handler: func(ctx context.Context, message *Message) error {
+			handled = append(handled, message.Offset)
+			if message.Offset == 1 {
+				return errors.New("session is over")
+			}
+			return nil
+		},
+	}
+	session := &fakeSession{ctx: context.Background(), marked: make(map[int32]int64)}
+
+	assert.Nil(t, (&consumerHandler{s: subscription}).ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{0, 1}, handled)
+	// the failed message is not marked, it is redelivered in the next session
+	assert.EqualValues(t, 1, session.marked[0])
+}
@@ -0,0 +1,276 @@
+package events
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	defaultMemoryPartitions = 4
+	defaultMemoryBufferSize = 1024
+	memoryRedeliveryBackoff = 100 * time.Millisecond
+)
+
+// MemoryBus is an in-process Publisher and Subscriber backed by channels, for
+// local development and tests. Like kafka, a topic is split into partitions by
+// message key and every consumer group receives every message. Messages are
+// lost when the process exits.
+type MemoryBus struct {
+	logger     *zap.Logger
+	partitions int
+	bufferSize int
+
+	mu     sync.RWMutex
+	closed bool
+	groups map[string][]*memorySubscription
+	offset map[string][]int64
+}
+
+func NewMemoryBus(logger *zap.Logger) *MemoryBus {
+	partitions := viper.GetInt("eventbus.memory.partitions")
+	if partitions <= 0 {
+		partitions = defaultMemoryPartitions
+	}
+	bufferSize := viper.GetInt("eventbus.memory.buffer_size")
+	if bufferSize <= 0 {
+		bufferSize = defaultMemoryBufferSize
+	}
+
+	return &MemoryBus{
+		logger:     logger,
+		partitions: partitions,
+		bufferSize: bufferSize,
+		groups:     make(map[string][]*memorySubscription),
+		offset:     make(map[string][]int64),
+	}
+}
+
+// Publish hands the message to every subscription of the topic, done is called
+// before Publish returns. Messages published while a topic has no
+// subscription are dropped.
+func (b *MemoryBus) Publish(ctx context.Context, topic, key string, value []byte, done func(error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	span, headers := startPublishSpan(ctx, topic, key)
+
+	if b.closed {
+		tracing.End(span, ErrClosed)
+		return ErrClosed
+	}
+
+	partition := b.partition(key)
+	subscriptions := b.groups[topic]
+	for _, subscription := range subscriptions {
+		if len(subscription.partitions[partition]) == cap(subscription.partitions[partition]) {
+			tracing.End(span, ErrBufferFull)
+			return ErrBufferFull
+		}
+	}
+
+	if b.offset[topic] == nil {
+		b.offset[topic] = make([]int64, b.partitions)
+	}
+	message := &Message{
+		Topic:     topic,
+		Key:       key,
+		Value:     value,
+		Headers:   headers,
+		Partition: partition,
+		Offset:    b.offset[topic][partition],
+		Timestamp: time.Now(),
+	}
+	b.offset[topic][partition]++
+
+	for _, subscription := range subscriptions {
+		subscription.partitions[partition] <- message
+	}
+	span.End()
+
+	if done != nil {
+		done(nil)
+	}
+
+	return nil
+}
+
+// Flush returns immediately, messages are handed over synchronously.
+func (b *MemoryBus) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (b *MemoryBus) Check(ctx context.Context) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close stops every subscription.
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	var subscriptions []*memorySubscription
+	for _, group := range b.groups {
+		subscriptions = append(subscriptions, group...)
+	}
+	b.groups = make(map[string][]*memorySubscription)
+	b.mu.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.stop()
+	}
+
+	return nil
+}
+
+// Subscribe starts consuming the topic. A second subscription with the same
+// group shares nothing with the first one, groups are not load balanced.
+func (b *MemoryBus) Subscribe(topic, group string, handler Handler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	subscription := &memorySubscription{
+		bus:        b,
+		topic:      topic,
+		group:      group,
+		handler:    handler,
+		partitions: make([]chan *Message, b.partitions),
+		committed:  make([]int64, b.partitions),
+		ctx:        ctx,
+		cancelFn:   cancel,
+	}
+	// messages published before the subscription are not delivered to it
+	copy(subscription.committed, b.offset[topic])
+	for i := range subscription.partitions {
+		subscription.partitions[i] = make(chan *Message, b.bufferSize)
+		subscription.wg.Add(1)
+		go subscription.consume(subscription.partitions[i])
+	}
+	b.groups[topic] = append(b.groups[topic], subscription)
+
+	return subscription, nil
+}
+
+func (b *MemoryBus) partition(key string) int32 {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+	return int32(hasher.Sum32() % uint32(b.partitions))
+}
+
+type memorySubscription struct {
+	bus        *MemoryBus
+	topic      string
+	group      string
+	handler    Handler
+	partitions []chan *Message
+	committed  []int64
+	ctx        context.Context
+	cancelFn   context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// consume hands the messages of a partition to the handler one by one. A
+// failed message is redelivered until it succeeds or the subscription stops.
+func (s *memorySubscription) consume(messages <-chan *Message) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case queued := <-messages:
+			// queued messages are shared by every group, the copy carries the
+			// lag of this subscription
+			message := *queued
+			message.HighWaterMark = message.Offset + 1 + int64(len(messages))
+			for {
+				ctx, span := startConsumeSpan(s.ctx, s.group, &message)
+				err := s.handler(ctx, &message)
+				tracing.End(span, err)
+				if err == nil {
+					atomic.StoreInt64(&s.committed[message.Partition], message.Offset+1)
+					break
+				}
+
+				s.bus.logger.Warn("Handle message failed",
+					zap.Error(err),
+					zap.String("topic", message.Topic),
+					zap.String("group", s.group),
+					zap.Int32("partition", message.Partition),
+					zap.Int64("offset", message.Offset))
+
+				select {
+				case <-time.After(memoryRedeliveryBackoff):
+				case <-s.ctx.Done():
+					return
+				}
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *memorySubscription) Check(ctx context.Context) error {
+	if s.ctx.Err() != nil {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Lag compares the offset after the last handled message of every partition
+// with the offset the next published message will get.
+func (s *memorySubscription) Lag() ([]PartitionLag, error) {
+	s.bus.mu.RLock()
+	defer s.bus.mu.RUnlock()
+
+	lags := make([]PartitionLag, 0, len(s.committed))
+	for i := range s.committed {
+		var highWaterMark int64
+		if offsets := s.bus.offset[s.topic]; offsets != nil {
+			highWaterMark = offsets[i]
+		}
+		committed := atomic.LoadInt64(&s.committed[i])
+		lags = append(lags, PartitionLag{
+			Partition:     int32(i),
+			Committed:     committed,
+			HighWaterMark: highWaterMark,
+			Lag:           highWaterMark - committed,
+		})
+	}
+	return lags, nil
+}
+
+func (s *memorySubscription) Close() error {
+	s.bus.mu.Lock()
+	subscriptions := s.bus.groups[s.topic]
+	for i, subscription := range subscriptions {
+		if subscription == s {
+			s.bus.groups[s.topic] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			break
+		}
+	}
+	s.bus.mu.Unlock()
+
+	s.stop()
+	return nil
+}
+
+func (s *memorySubscription) stop() {
+	s.cancelFn()
+	s.wg.Wait()
+}
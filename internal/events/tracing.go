@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startPublishSpan starts the producer span of a message, the returned headers
+// carry it to the consumers.
+func startPublishSpan(ctx context.Context, topic, key string) (trace.Span, map[string]string) {
+	ctx, span := tracing.Tracer().Start(ctx, topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingDestinationKey.String(topic),
+			semconv.MessagingKafkaMessageKeyKey.String(key),
+		))
+
+	return span, tracing.Inject(ctx)
+}
+
+// startConsumeSpan starts the consumer span of a message as a child of the
+// producer span found in its headers. The returned context is handed to the
+// handler.
+func startConsumeSpan(ctx context.Context, group string, message *Message) (context.Context, trace.Span) {
+	ctx = tracing.Extract(ctx, message.Headers)
+
+	return tracing.Tracer().Start(ctx, message.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("kafka"),
+			semconv.MessagingDestinationKindTopic,
+			semconv.MessagingDestinationKey.String(message.Topic),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingKafkaConsumerGroupKey.String(group),
+			semconv.MessagingKafkaPartitionKey.Int64(int64(message.Partition)),
+			attribute.Int64("messaging.kafka.offset", message.Offset),
+		))
+}
+
+func toRecordHeaders(headers map[string]string) []sarama.RecordHeader {
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for key, value := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return recordHeaders
+}
+
+func fromRecordHeaders(recordHeaders []*sarama.RecordHeader) map[string]string {
+	headers := make(map[string]string, len(recordHeaders))
+	for _, header := range recordHeaders {
+		headers[string(header.Key)] = string(header.Value)
+	}
+	return headers
+}
@@ -0,0 +1,58 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/events"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestTraceContinuesInHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	bus := events.NewMemoryBus(zap.NewNop())
+	defer bus.Close()
+
+	handled := make(chan trace.SpanContext, 1)
+	_, err := bus.Subscribe("product-activities", "tracing-test", func(ctx context.Context, message *events.Message) error {
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "GET /api/v1/products/:id")
+	assert.Nil(t, bus.Publish(ctx, "product-activities", "1", []byte(`{}`), nil))
+	request.End()
+
+	var consumed trace.SpanContext
+	select {
+	case consumed = <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("message was not handled")
+	}
+	assert.Equal(t, request.SpanContext().TraceID(), consumed.TraceID())
+
+	// request -> send -> process
+	assert.Eventually(t, func() bool {
+		return len(recorder.Ended()) == 3
+	}, time.Second, 10*time.Millisecond)
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	assert.Equal(t, request.SpanContext().SpanID(), spans["product-activities send"].Parent().SpanID())
+	assert.Equal(t, spans["product-activities send"].SpanContext().SpanID(), spans["product-activities process"].Parent().SpanID())
+	assert.Equal(t, consumed.SpanID(), spans["product-activities process"].SpanContext().SpanID())
+}
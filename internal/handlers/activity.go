@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// recordActivity records the activity of the customer or, for anonymous
+// requests, of the visitor of ctx. Activities are not recorded for api keys.
+func (h *handler) recordActivity(ctx context.Context, action string, data interface{}) {
+	dataBytes, _ := json.Marshal(data)
+	activity := &models.CustomerActivity{
+		CreatedAt: time.Now().UnixMilli(),
+		Action:    action,
+		Data:      string(dataBytes),
+	}
+
+	// activities are keyed by user, so all activities of a user land on the
+	// same partition and are consumed in order. Visitors are keyed by visitor
+	// id for the same reason.
+	if userID, ok := auth.CustomerID(ctx); ok {
+		activity.UserID = userID
+		h.publishActivity(ctx, cast.ToString(userID), activity)
+		return
+	}
+	if visitorID, ok := auth.VisitorID(ctx); ok {
+		activity.VisitorID = visitorID
+		h.publishActivity(ctx, visitorID, activity)
+	}
+}
+
+// identifyVisitor records that the visitor logged in as the customer, the
+// consumer then merges the history of the visitor into the timeline of the
+// customer. It is keyed by visitor, so it is consumed after every activity the
+// visitor made before.
+func (h *handler) identifyVisitor(ctx context.Context, visitorID string, customerID uint) {
+	h.publishActivity(ctx, visitorID, &models.CustomerActivity{
+		UserID:    customerID,
+		VisitorID: visitorID,
+		CreatedAt: time.Now().UnixMilli(),
+		Action:    models.CustomAction_IdentifyVisitor,
+	})
+}
+
+// publishActivity writes the activity to the outbox, the outbox relay takes
+// care of publishing it to the event bus. A failure here is logged only, it
+// must not fail the request which triggered the activity. The trace context of
+// the request travels with the activity up to the consumer.
+func (h *handler) publishActivity(ctx context.Context, key string, activity *models.CustomerActivity) {
+	activity.EventID = models.NewEventID()
+	activityBytes, _ := json.Marshal(activity)
+
+	message, err := h.repo.CreateOutboxMessage(ctx, viper.GetString("kafka.topic"), key, string(activityBytes), tracing.Inject(ctx))
+	if err != nil {
+		h.log(ctx).Error("Record customer activity failed", zap.Error(err), zap.String("action", activity.Action))
+		return
+	}
+
+	h.log(ctx).Info("Recorded customer activity",
+		zap.String("action", activity.Action),
+		zap.Uint64("outbox_id", message.ID))
+}
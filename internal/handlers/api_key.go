@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `binding:"required,max=100"`
+	Scopes []string `binding:"required"`
+}
+
+// CreateAPIKey issues a key for a partner system. The key is only returned in
+// this response, it cannot be recovered afterwards.
+func (h *handler) CreateAPIKey(c *gin.Context) {
+	req := &CreateAPIKeyRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed api key request failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := auth.ValidateScopes(req.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		h.log(c.Request.Context()).Error("Generate api key failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create api key failed"})
+		return
+	}
+
+	createdBy, _ := auth.CustomerID(c.Request.Context())
+	apiKey, err := h.repo.CreateAPIKey(c.Request.Context(), req.Name, prefix, hash, req.Scopes, createdBy)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Create api key failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Create api key failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Created api key", zap.Uint("id", apiKey.ID), zap.Strings("scopes", apiKey.Scopes))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": gin.H{
+			"apiKey": apiKey,
+			"key":    key,
+		},
+	})
+}
+
+func (h *handler) GetAPIKeys(c *gin.Context) {
+	apiKeys, err := h.repo.GetAPIKeys(c.Request.Context())
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get api keys failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get api keys failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": apiKeys,
+	})
+}
+
+// RotateAPIKey revokes the key and issues a new one with the same scopes.
+func (h *handler) RotateAPIKey(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "api key id is invalid"})
+		return
+	}
+
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		h.log(c.Request.Context()).Error("Generate api key failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rotate api key failed"})
+		return
+	}
+
+	createdBy, _ := auth.CustomerID(c.Request.Context())
+	apiKey, err := h.repo.RotateAPIKey(c.Request.Context(), id, prefix, hash, createdBy)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found or already revoked"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Rotate api key failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Rotate api key failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Rotated api key", zap.Uint("id", id), zap.Uint("new_id", apiKey.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"apiKey": apiKey,
+			"key":    key,
+		},
+	})
+}
+
+func (h *handler) RevokeAPIKey(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "api key id is invalid"})
+		return
+	}
+
+	err := h.repo.RevokeAPIKey(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "api key not found or already revoked"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Revoke api key failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Revoke api key failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Revoked api key", zap.Uint("id", id))
+
+	c.Status(http.StatusNoContent)
+}
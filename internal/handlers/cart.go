@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type AddCartItemRequest struct {
+	ProductID uint `binding:"required"`
+	Quantity  uint `binding:"required,min=1,max=100"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity uint `binding:"required,min=1,max=100"`
+}
+
+// cartOwner returns the customer, or the anonymous visitor, whose cart the
+// request is about. Api keys have no cart.
+func cartOwner(ctx context.Context) (uint, string, bool) {
+	if customerID, ok := auth.CustomerID(ctx); ok {
+		return customerID, "", true
+	}
+	if visitorID, ok := auth.VisitorID(ctx); ok {
+		return 0, visitorID, true
+	}
+	return 0, "", false
+}
+
+// cartActivity is the data of the cart activities.
+type cartActivity struct {
+	ProductID uint `json:"productId"`
+	Quantity  uint `json:"quantity"`
+}
+
+func (h *handler) GetCart(c *gin.Context) {
+	customerID, visitorID, ok := cartOwner(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers and visitors have a cart"})
+		return
+	}
+
+	h.respondCart(c, customerID, visitorID)
+}
+
+// AddCartItem adds the product to the cart, on top of the quantity already in
+// the cart.
+func (h *handler) AddCartItem(c *gin.Context) {
+	customerID, visitorID, ok := cartOwner(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers and visitors have a cart"})
+		return
+	}
+
+	req := &AddCartItemRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed cart item failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.repo.GetProductByID(c.Request.Context(), req.ProductID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get product failed", zap.Error(err), zap.Uint("product_id", req.ProductID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Add cart item failed"})
+		return
+	}
+
+	if err := h.repo.AddCartItem(c.Request.Context(), customerID, visitorID, req.ProductID, req.Quantity); err != nil {
+		h.log(c.Request.Context()).Error("Add cart item failed", zap.Error(err), zap.Uint("product_id", req.ProductID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Add cart item failed"})
+		return
+	}
+
+	h.recordActivity(c.Request.Context(), models.CustomAction_AddToCart, &cartActivity{ProductID: req.ProductID, Quantity: req.Quantity})
+
+	h.respondCart(c, customerID, visitorID)
+}
+
+// UpdateCartItem sets the quantity of a product in the cart. The change is
+// recorded as products added to or removed from the cart.
+func (h *handler) UpdateCartItem(c *gin.Context) {
+	customerID, visitorID, ok := cartOwner(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers and visitors have a cart"})
+		return
+	}
+
+	productID := cast.ToUint(c.Param("product_id"))
+	if productID == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "product id is invalid"})
+		return
+	}
+
+	req := &UpdateCartItemRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed cart item failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previous, err := h.repo.SetCartItemQuantity(c.Request.Context(), customerID, visitorID, productID, req.Quantity)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Update cart item failed", zap.Error(err), zap.Uint("product_id", productID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Update cart item failed"})
+		return
+	}
+
+	switch {
+	case req.Quantity > previous:
+		h.recordActivity(c.Request.Context(), models.CustomAction_AddToCart, &cartActivity{ProductID: productID, Quantity: req.Quantity - previous})
+	case req.Quantity < previous:
+		h.recordActivity(c.Request.Context(), models.CustomAction_RemoveFromCart, &cartActivity{ProductID: productID, Quantity: previous - req.Quantity})
+	}
+
+	h.respondCart(c, customerID, visitorID)
+}
+
+func (h *handler) RemoveCartItem(c *gin.Context) {
+	customerID, visitorID, ok := cartOwner(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers and visitors have a cart"})
+		return
+	}
+
+	productID := cast.ToUint(c.Param("product_id"))
+	if productID == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "product id is invalid"})
+		return
+	}
+
+	removed, err := h.repo.RemoveCartItem(c.Request.Context(), customerID, visitorID, productID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the cart"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Remove cart item failed", zap.Error(err), zap.Uint("product_id", productID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Remove cart item failed"})
+		return
+	}
+
+	h.recordActivity(c.Request.Context(), models.CustomAction_RemoveFromCart, &cartActivity{ProductID: productID, Quantity: removed})
+
+	h.respondCart(c, customerID, visitorID)
+}
+
+// respondCart answers with the cart priced as checkout would price it without
+// a coupon: the current product prices, the automatic promotions and the
+// shipping and the tax of the region query.
+func (h *handler) respondCart(c *gin.Context, customerID uint, visitorID string) {
+	quote, ok := h.priceCart(c, customerID, visitorID, "", c.Query("region"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": quote,
+	})
+}
+
+// priceCart quotes the cart with the pricer of checkout, the coupon of code
+// and the shipping and the tax of region. It answers the error itself when
+// the cart cannot be priced.
+func (h *handler) priceCart(c *gin.Context, customerID uint, visitorID, code, region string) (*pricing.Quote, bool) {
+	lines, err := h.repo.GetCartLines(c.Request.Context(), customerID, visitorID)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get cart failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get cart failed"})
+		return nil, false
+	}
+	candidates, err := h.repo.GetCartPromotions(c.Request.Context(), code)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get cart promotions failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get cart failed"})
+		return nil, false
+	}
+
+	quote, err := h.pricer.Price(lines, candidates, code, region, time.Now())
+	if promotions.IsCouponError(err) || errors.Is(err, pricing.ErrUnknownRegion) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Price cart failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Get cart failed"})
+		return nil, false
+	}
+
+	return quote, true
+}
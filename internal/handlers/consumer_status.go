@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/consumers"
+)
+
+type consumerStats interface {
+	Stats() consumers.ConsumerStats
+}
+
+// RegisterConsumerStatus serves the status of the consumer on
+// /consumer/status of the group. It tells the topic, the consumer group and
+// the lag of every partition, so it is restricted to who manages settings.
+func (h *handler) RegisterConsumerStatus(v1 *gin.RouterGroup, consumer consumerStats) {
+	v1.GET("/consumer/status", append(h.Authorize(auth.Permission_ManageSettings), ConsumerStatus(consumer))...)
+}
+
+// ConsumerStatus reports the lag and throughput of a consumer running in this
+// process.
+func ConsumerStatus(consumer consumerStats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"data": consumer.Stats(),
+		})
+	}
+}
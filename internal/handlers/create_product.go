@@ -8,22 +8,24 @@ import (
 )
 
 type CreateProductRequest struct {
-	Name  string
-	Price uint
+	Name     string
+	Category string `binding:"max=50"`
+	Price    uint
+	Weight   uint
 }
 
 func (h *handler) CreateProduct(c *gin.Context) {
 	productInfo := &CreateProductRequest{}
 	if err := c.ShouldBindJSON(productInfo); err != nil {
-		h.logger.Error("Parsed product info failed", zap.Error(err))
+		h.log(c.Request.Context()).Error("Parsed product info failed", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	product, err := h.repo.CreateProduct(productInfo.Name, productInfo.Price)
+	product, err := h.repo.CreateProduct(c.Request.Context(), productInfo.Name, productInfo.Category, productInfo.Price, productInfo.Weight)
 	if err != nil {
-		h.logger.Error("Create product failed", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Create product failed"})
+		h.log(c.Request.Context()).Error("Create product failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusBadRequest), gin.H{"error": "Create product failed"})
 		return
 	}
 
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RegisterRequest struct {
+	Email    string `binding:"required,email"`
+	Name     string `binding:"required,max=100"`
+	Password string `binding:"required"`
+}
+
+type LoginRequest struct {
+	Email    string `binding:"required"`
+	Password string `binding:"required"`
+}
+
+func (h *handler) Register(c *gin.Context) {
+	req := &RegisterRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed register request failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := h.repo.CreateCustomer(c.Request.Context(), strings.ToLower(req.Email), req.Name, passwordHash)
+	if errors.Is(err, models.ErrCustomerExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Create customer failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Create customer failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": customer,
+	})
+}
+
+// Login checks the credentials and starts a session, the token is set as a
+// cookie and also returned for clients which do not keep cookies. The history
+// and the cart the customer made as an anonymous visitor are merged into
+// their own, and the visitor cookie is cleared so that a later anonymous
+// visitor on the same browser starts a history of their own.
+func (h *handler) Login(c *gin.Context) {
+	req := &LoginRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed login request failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := h.repo.GetCustomerByEmail(c.Request.Context(), strings.ToLower(req.Email))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.log(c.Request.Context()).Error("Get customer failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Login failed"})
+		return
+	}
+	// unknown emails and wrong passwords get the same answer in the same
+	// time, the password of an unknown email is checked against a dummy hash
+	passwordHash := ""
+	if customer != nil {
+		passwordHash = customer.PasswordHash
+	}
+	if !auth.CheckPassword(passwordHash, req.Password) || customer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "email or password is invalid"})
+		return
+	}
+
+	token, expiresAt := h.sessions.Issue(customer.ID)
+	h.sessions.SetCookie(c, token, expiresAt)
+
+	if visitorID, ok := h.sessions.Visitor(c); ok {
+		// like the activities, a cart which cannot be merged must not fail
+		// the login
+		if err := h.repo.MergeCarts(c.Request.Context(), visitorID, customer.ID); err != nil {
+			h.log(c.Request.Context()).Error("Merge carts failed", zap.Error(err), zap.Uint("customer_id", customer.ID))
+		}
+		h.identifyVisitor(c.Request.Context(), visitorID, customer.ID)
+		h.sessions.ClearVisitorCookie(c)
+	}
+
+	h.log(c.Request.Context()).Info("Customer logged in", zap.Uint("customer_id", customer.ID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"customer":  customer,
+			"token":     token,
+			"expiresAt": expiresAt.UnixMilli(),
+		},
+	})
+}
+
+func (h *handler) Logout(c *gin.Context) {
+	h.sessions.ClearCookie(c)
+	c.Status(http.StatusNoContent)
+}
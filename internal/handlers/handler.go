@@ -1,49 +1,107 @@
 package handlers
 
 import (
-	"github.com/Shopify/sarama"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
 	"github.com/ldmtam/ecommerce-demo/internal/models"
-	"github.com/spf13/viper"
+	"github.com/ldmtam/ecommerce-demo/internal/payments"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
 	"go.uber.org/zap"
 )
 
 type repository interface {
-	CreateProduct(name string, price uint) (*models.Product, error)
-	GetProductByID(id uint) (*models.Product, error)
-	GetProductByName(name string, limit uint) ([]*models.Product, error)
-	GetCustomerActivities(id uint, limit uint) ([]*models.CustomerActivity, error)
-	GetCustomerActivitiesByAction(id uint, action string, limit uint) ([]*models.CustomerActivity, error)
+	CreateProduct(ctx context.Context, name, category string, price, weight uint) (*models.Product, error)
+	GetProductByID(ctx context.Context, id uint) (*models.Product, error)
+	GetProductByName(ctx context.Context, name string, limit uint) ([]*models.Product, error)
+	UpdateProduct(ctx context.Context, product *models.Product) (*models.Product, *models.OutboxMessage, error)
+	GetCustomerActivities(ctx context.Context, id uint, limit uint) ([]*models.CustomerActivity, error)
+	GetCustomerActivitiesByAction(ctx context.Context, id uint, action string, limit uint) ([]*models.CustomerActivity, error)
+	CreateOutboxMessage(ctx context.Context, topic, key, payload string, headers map[string]string) (*models.OutboxMessage, error)
+	CreateCustomer(ctx context.Context, email, name, passwordHash string) (*models.Customer, error)
+	GetCustomerByEmail(ctx context.Context, email string) (*models.Customer, error)
+	GetCustomerRole(ctx context.Context, id uint) (string, error)
+	CreateAPIKey(ctx context.Context, name, prefix, hash string, scopes []string, createdBy uint) (*models.APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uint) error
+	RotateAPIKey(ctx context.Context, id uint, prefix, hash string, createdBy uint) (*models.APIKey, error)
+	GetCartLines(ctx context.Context, customerID uint, visitorID string) ([]*models.CartLine, error)
+	AddCartItem(ctx context.Context, customerID uint, visitorID string, productID, quantity uint) error
+	SetCartItemQuantity(ctx context.Context, customerID uint, visitorID string, productID, quantity uint) (uint, error)
+	RemoveCartItem(ctx context.Context, customerID uint, visitorID string, productID uint) (uint, error)
+	MergeCarts(ctx context.Context, visitorID string, customerID uint) error
+	CreateOrderFromCart(ctx context.Context, customerID uint, pricer *pricing.Pricer, couponCode, region string) (*models.Order, error)
+	GetOrders(ctx context.Context, customerID uint, status string, limit uint) ([]*models.Order, error)
+	GetOrder(ctx context.Context, id uint) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, id uint, status string) (*models.Order, error)
+	ApplyOrderPayment(ctx context.Context, id uint, intentID, status string) (*models.Order, error)
+	GetCartPromotions(ctx context.Context, code string) ([]*models.Promotion, error)
+	CreatePromotion(ctx context.Context, promotion *models.Promotion) (*models.Promotion, error)
+	GetPromotions(ctx context.Context) ([]*models.Promotion, error)
+	GetPromotion(ctx context.Context, id uint) (*models.Promotion, error)
+	UpdatePromotion(ctx context.Context, promotion *models.Promotion) (*models.Promotion, error)
+	DeletePromotion(ctx context.Context, id uint) error
+	GetWishlist(ctx context.Context, customerID uint) ([]*models.WishlistLine, error)
+	AddWishlistItem(ctx context.Context, customerID, productID uint) error
+	RemoveWishlistItem(ctx context.Context, customerID, productID uint) error
+	GetNotifications(ctx context.Context, customerID uint, unread bool, limit uint) ([]*models.Notification, error)
+	ReadNotification(ctx context.Context, customerID, id uint) (*models.Notification, error)
 }
 
 type handler struct {
-	logger   *zap.Logger
-	repo     repository
-	producer sarama.SyncProducer
+	logger        *zap.Logger
+	repo          repository
+	sessions      *auth.Sessions
+	authenticator *auth.Authenticator
+	payments      payments.Gateway
+	pricer        *pricing.Pricer
 }
 
-func New(logger *zap.Logger, repo repository) (*handler, error) {
-	producer, err := initProducer(logger, viper.GetStringSlice("kafka.brokers"))
-	if err != nil {
-		return nil, err
+// errorStatus is the status answering a failed repository call, 504 when the
+// call ran out of time and status otherwise.
+func errorStatus(err error, status int) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
 	}
-
-	return &handler{
-		logger:   logger,
-		repo:     repo,
-		producer: producer,
-	}, nil
+	return status
 }
 
-func initProducer(logger *zap.Logger, brokers []string) (sarama.SyncProducer, error) {
-	logger.Info("Creating kafka producer...")
+// log returns the logger of the request ctx belongs to.
+func (h *handler) log(ctx context.Context) *zap.Logger {
+	return requestid.Logger(ctx, h.logger)
+}
 
-	config := sarama.NewConfig()
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Return.Successes = true
-	producer, err := sarama.NewSyncProducer(brokers, config)
+// Authorize returns the middlewares restricting a route to the customers whose
+// role has permission and to the api keys having it in their scopes.
+func (h *handler) Authorize(permission string) gin.HandlersChain {
+	return gin.HandlersChain{
+		h.authenticator.Middleware(),
+		auth.RequirePermission(h.repo, permission),
+	}
+}
 
-	logger.Info("Successfully created kafka producer")
+// AllowVisitors is Authorize for the routes open to anonymous visitors, which
+// are given a visitor id to record their activities with.
+func (h *handler) AllowVisitors(permission string) gin.HandlersChain {
+	return gin.HandlersChain{
+		h.authenticator.Optional(),
+		auth.RequirePermission(h.repo, permission),
+		h.sessions.Visitors(),
+	}
+}
 
-	return producer, err
+func New(logger *zap.Logger, repo repository, sessions *auth.Sessions, gateway payments.Gateway, pricer *pricing.Pricer) (*handler, error) {
+	return &handler{
+		logger:        logger,
+		repo:          repo,
+		sessions:      sessions,
+		authenticator: auth.NewAuthenticator(sessions, repo),
+		payments:      gateway,
+		pricer:        pricer,
+	}, nil
 }
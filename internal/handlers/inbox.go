@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// GetNotifications lists the latest notifications of the customer, only the
+// unread ones with the unread=true query.
+func (h *handler) GetNotifications(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have an inbox"})
+		return
+	}
+
+	notifications, err := h.repo.GetNotifications(c.Request.Context(), customerID, cast.ToBool(c.Query("unread")), 50)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get notifications failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get notifications failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": notifications,
+	})
+}
+
+// ReadNotification marks a notification of the customer as read. The
+// notifications of other customers are answered as not found.
+func (h *handler) ReadNotification(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have an inbox"})
+		return
+	}
+
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "notification id is invalid"})
+		return
+	}
+
+	notification, err := h.repo.ReadNotification(c.Request.Context(), customerID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Read notification failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Read notification failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": notification,
+	})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CheckoutRequest names the coupon and the region the order ships to, the
+// default region of the pricing configuration when it is empty.
+type CheckoutRequest struct {
+	CouponCode string `binding:"max=32"`
+	Region     string `binding:"max=10"`
+}
+
+type UpdateOrderStatusRequest struct {
+	Status string `binding:"required"`
+}
+
+// Checkout turns the cart of the customer into a pending order, priced with
+// the promotions, the optional coupon, the shipping and the tax of the region
+// of the request. Visitors have to log in first, their cart is merged into the
+// cart of the customer then.
+func (h *handler) Checkout(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers can place orders"})
+		return
+	}
+
+	req := &CheckoutRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(req); err != nil {
+			h.log(c.Request.Context()).Error("Parsed checkout failed", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	order, err := h.repo.CreateOrderFromCart(c.Request.Context(), customerID, h.pricer, req.CouponCode, req.Region)
+	if errors.Is(err, models.ErrEmptyCart) || promotions.IsCouponError(err) || errors.Is(err, pricing.ErrUnknownRegion) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Checkout failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Checkout failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Placed order", zap.Uint("order_id", order.ID), zap.Uint("total", order.Total), zap.Uint("discount", order.Discount), zap.String("region", order.Region))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": order,
+	})
+}
+
+// GetOrders lists the latest orders of the customer.
+func (h *handler) GetOrders(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have orders"})
+		return
+	}
+
+	orders, err := h.repo.GetOrders(c.Request.Context(), customerID, "", 20)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get orders failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get orders failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orders,
+	})
+}
+
+// GetOrder returns an order of the customer. The orders of other customers are
+// answered as not found.
+func (h *handler) GetOrder(c *gin.Context) {
+	order, ok := h.ownOrder(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": order,
+	})
+}
+
+// CancelOrder lets the customer cancel an order which is not paid yet, the
+// coupon of the order can be used again.
+func (h *handler) CancelOrder(c *gin.Context) {
+	order, ok := h.ownOrder(c)
+	if !ok {
+		return
+	}
+
+	h.updateOrderStatus(c, order.ID, models.OrderStatus_Cancelled)
+}
+
+// GetAllOrders lists the latest orders of every customer, or of the customer
+// and with the status given in the query.
+func (h *handler) GetAllOrders(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !models.IsOrderStatus(status) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "order status is invalid"})
+		return
+	}
+
+	orders, err := h.repo.GetOrders(c.Request.Context(), cast.ToUint(c.Query("customerId")), status, 20)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get orders failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get orders failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orders,
+	})
+}
+
+// UpdateOrderStatus moves an order through its lifecycle, for instance when it
+// ships. Moves the lifecycle does not allow are rejected with 409, refunds of
+// orders paid at the payment gateway are refunded there first. Orders are only
+// paid by their payment, never by hand.
+func (h *handler) UpdateOrderStatus(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "order id is invalid"})
+		return
+	}
+
+	req := &UpdateOrderStatusRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed order status failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.IsOrderStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order status is invalid"})
+		return
+	}
+	if req.Status == models.OrderStatus_Paid {
+		c.JSON(http.StatusConflict, gin.H{"error": "orders are paid by their payment only"})
+		return
+	}
+	if req.Status == models.OrderStatus_Refunded {
+		h.refundOrder(c, id)
+		return
+	}
+
+	h.updateOrderStatus(c, id, req.Status)
+}
+
+func (h *handler) updateOrderStatus(c *gin.Context, id uint, status string) {
+	order, err := h.repo.UpdateOrderStatus(c.Request.Context(), id, status)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Update order status failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Update order status failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Updated order status", zap.Uint("order_id", order.ID), zap.String("status", order.Status))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": order,
+	})
+}
+
+// ownOrder returns the order of the id parameter if it belongs to the
+// customer, otherwise the request is answered.
+func (h *handler) ownOrder(c *gin.Context) (*models.Order, bool) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have orders"})
+		return nil, false
+	}
+
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "order id is invalid"})
+		return nil, false
+	}
+
+	order, err := h.repo.GetOrder(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && order.CustomerID != customerID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return nil, false
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get order failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get order failed"})
+		return nil, false
+	}
+
+	return order, true
+}
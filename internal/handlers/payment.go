@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/payments"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type PayOrderRequest struct {
+	PaymentMethod string `binding:"required"`
+}
+
+// webhookOrderStatuses maps the payment events to the status they move the
+// order of the intent to, other events are ignored.
+var webhookOrderStatuses = map[string]string{
+	payments.EventType_Captured: models.OrderStatus_Paid,
+	payments.EventType_Refunded: models.OrderStatus_Refunded,
+}
+
+// orderPaymentKey is the idempotency key of the payment of an order, paying
+// an order again never charges the customer twice.
+func orderPaymentKey(orderID uint) string {
+	return fmt.Sprintf("order-%d", orderID)
+}
+
+// paymentStatus is the status answering a failed call to the payment gateway.
+func paymentStatus(err error) int {
+	switch {
+	case errors.Is(err, payments.ErrDeclined):
+		return http.StatusPaymentRequired
+	case errors.Is(err, payments.ErrInvalidRequest):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, payments.ErrIdempotencyConflict), errors.Is(err, payments.ErrInvalidState):
+		return http.StatusConflict
+	default:
+		return errorStatus(err, http.StatusBadGateway)
+	}
+}
+
+// PayOrder authorizes and captures the total of a pending order of the
+// customer with the payment method of the request, then marks it paid.
+// Retrying a payment which went through answers the paid order again, an order
+// which moved on, like a shipped one, cannot be paid again. An order cancelled
+// while its payment was captured has its payment refunded.
+func (h *handler) PayOrder(c *gin.Context) {
+	order, ok := h.ownOrder(c)
+	if !ok {
+		return
+	}
+
+	req := &PayOrderRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed payment failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// do not charge orders which cannot be paid anymore, like cancelled or
+	// shipped ones, only a paid order may retry the payment which paid it
+	retry := order.PaymentIntentID != "" && order.Status == models.OrderStatus_Paid
+	if !retry && !order.CanTransition(models.OrderStatus_Paid) {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrInvalidTransition.Error()})
+		return
+	}
+
+	intent, err := h.payments.Authorize(c.Request.Context(), &payments.AuthorizeRequest{
+		IdempotencyKey: orderPaymentKey(order.ID),
+		Reference:      strconv.FormatUint(uint64(order.ID), 10),
+		Amount:         order.Total,
+		PaymentMethod:  req.PaymentMethod,
+	})
+	if err != nil {
+		h.log(c.Request.Context()).Warn("Authorize payment failed", zap.Error(err), zap.Uint("order_id", order.ID))
+		c.JSON(paymentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// an intent authorized by an earlier call may already be captured
+	captured := intent.Status != payments.IntentStatus_Captured
+	if _, err := h.payments.Capture(c.Request.Context(), intent.ID); err != nil {
+		h.log(c.Request.Context()).Error("Capture payment failed", zap.Error(err), zap.Uint("order_id", order.ID), zap.String("payment_intent_id", intent.ID))
+		c.JSON(paymentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	paid, err := h.repo.ApplyOrderPayment(c.Request.Context(), order.ID, intent.ID, models.OrderStatus_Paid)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		h.refundUnpaidOrder(c.Request.Context(), order.ID, intent.ID, captured)
+	}
+	h.respondOrderPayment(c, order.ID, intent.ID, paid, err)
+}
+
+// refundUnpaidOrder refunds the payment captured for an order which could not
+// be marked paid, so the customer is not charged for it. A payment captured by
+// an earlier call is only refunded when the order was cancelled, the order may
+// have moved on with it otherwise.
+func (h *handler) refundUnpaidOrder(ctx context.Context, orderID uint, intentID string, captured bool) {
+	if !captured {
+		order, err := h.repo.GetOrder(ctx, orderID)
+		if err != nil {
+			h.log(ctx).Error("Get unpaid order failed", zap.Error(err), zap.Uint("order_id", orderID), zap.String("payment_intent_id", intentID))
+			return
+		}
+		if order.Status != models.OrderStatus_Cancelled {
+			return
+		}
+	}
+
+	if _, err := h.payments.Refund(ctx, intentID); err != nil {
+		h.log(ctx).Error("Refund payment of unpaid order failed", zap.Error(err), zap.Uint("order_id", orderID), zap.String("payment_intent_id", intentID))
+		return
+	}
+
+	h.log(ctx).Warn("Refunded payment of unpaid order", zap.Uint("order_id", orderID), zap.String("payment_intent_id", intentID))
+}
+
+// refundOrder refunds an order. Orders paid at the payment gateway are
+// refunded there before they are marked refunded.
+func (h *handler) refundOrder(c *gin.Context, id uint) {
+	order, err := h.repo.GetOrder(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get order failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Refund order failed"})
+		return
+	}
+	if order.PaymentIntentID == "" {
+		h.updateOrderStatus(c, id, models.OrderStatus_Refunded)
+		return
+	}
+	if order.Status != models.OrderStatus_Refunded && !order.CanTransition(models.OrderStatus_Refunded) {
+		c.JSON(http.StatusConflict, gin.H{"error": models.ErrInvalidTransition.Error()})
+		return
+	}
+
+	if _, err := h.payments.Refund(c.Request.Context(), order.PaymentIntentID); err != nil {
+		h.log(c.Request.Context()).Error("Refund payment failed", zap.Error(err), zap.Uint("order_id", id), zap.String("payment_intent_id", order.PaymentIntentID))
+		c.JSON(paymentStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyOrderPayment(c, id, order.PaymentIntentID, models.OrderStatus_Refunded)
+}
+
+func (h *handler) applyOrderPayment(c *gin.Context, id uint, intentID, status string) {
+	order, err := h.repo.ApplyOrderPayment(c.Request.Context(), id, intentID, status)
+	h.respondOrderPayment(c, id, intentID, order, err)
+}
+
+// respondOrderPayment answers the order once the payment intentID is applied
+// to it, or why it could not be.
+func (h *handler) respondOrderPayment(c *gin.Context, id uint, intentID string, order *models.Order, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrPaymentMismatch) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Apply order payment failed", zap.Error(err), zap.Uint("id", id), zap.String("payment_intent_id", intentID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Apply order payment failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Applied order payment", zap.Uint("order_id", order.ID), zap.String("status", order.Status), zap.String("payment_intent_id", intentID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": order,
+	})
+}
+
+// PaymentWebhook applies the payment events of the gateway to the orders.
+// Events are delivered at least once and may arrive after the api already
+// applied the payment itself, applying them again does nothing. Events which
+// cannot apply are acknowledged anyway, redelivering them would not help.
+func (h *handler) PaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "webhook payload is invalid"})
+		return
+	}
+
+	event, err := h.payments.VerifyWebhook(payload, c.GetHeader(payments.SignatureHeader))
+	if err != nil {
+		h.log(c.Request.Context()).Warn("Verify payment webhook failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger := h.log(c.Request.Context()).With(
+		zap.String("event_id", event.ID),
+		zap.String("type", event.Type),
+		zap.String("payment_intent_id", event.Intent.ID))
+
+	status, ok := webhookOrderStatuses[event.Type]
+	if !ok {
+		logger.Debug("Ignored payment webhook")
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	id := cast.ToUint(event.Intent.Reference)
+	order, err := h.repo.ApplyOrderPayment(c.Request.Context(), id, event.Intent.ID, status)
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrPaymentMismatch) {
+		logger.Warn("Payment webhook does not apply to its order", zap.Error(err), zap.Uint("order_id", id))
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		logger.Error("Apply payment webhook failed", zap.Error(err), zap.Uint("order_id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Apply payment webhook failed"})
+		return
+	}
+
+	logger.Info("Applied payment webhook", zap.Uint("order_id", order.ID), zap.String("status", order.Status))
+
+	c.Status(http.StatusNoContent)
+}
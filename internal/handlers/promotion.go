@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// PromotionRequest is the rule of a promotion, see models.Promotion. StartsAt
+// and EndsAt are unix milliseconds.
+type PromotionRequest struct {
+	Name        string `binding:"required,max=100"`
+	Code        string `binding:"max=32"`
+	Type        string `binding:"required"`
+	Value       uint
+	BuyQuantity uint
+	GetQuantity uint
+	Category    string `binding:"max=50"`
+	MinSubtotal uint
+	UsageLimit  uint
+	StartsAt    int64
+	EndsAt      int64
+}
+
+// promotion returns the promotion of the request, an empty code makes it
+// apply without a coupon.
+func (r *PromotionRequest) promotion() *models.Promotion {
+	promotion := &models.Promotion{
+		Name:        r.Name,
+		Type:        r.Type,
+		Value:       r.Value,
+		BuyQuantity: r.BuyQuantity,
+		GetQuantity: r.GetQuantity,
+		Category:    r.Category,
+		MinSubtotal: r.MinSubtotal,
+		UsageLimit:  r.UsageLimit,
+		StartsAt:    r.StartsAt,
+		EndsAt:      r.EndsAt,
+	}
+	if code := models.NormalizeCouponCode(r.Code); code != "" {
+		promotion.Code = &code
+	}
+	return promotion
+}
+
+// bindPromotion parses and validates the promotion of the request, otherwise
+// the request is answered.
+func (h *handler) bindPromotion(c *gin.Context) (*models.Promotion, bool) {
+	req := &PromotionRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed promotion failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	promotion := req.promotion()
+	if err := promotion.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	return promotion, true
+}
+
+func (h *handler) CreatePromotion(c *gin.Context) {
+	promotion, ok := h.bindPromotion(c)
+	if !ok {
+		return
+	}
+
+	promotion, err := h.repo.CreatePromotion(c.Request.Context(), promotion)
+	if errors.Is(err, models.ErrCouponCodeExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Create promotion failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Create promotion failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Created promotion", zap.Uint("id", promotion.ID), zap.String("type", promotion.Type))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"data": promotion,
+	})
+}
+
+func (h *handler) GetPromotions(c *gin.Context) {
+	promotions, err := h.repo.GetPromotions(c.Request.Context())
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get promotions failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get promotions failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": promotions,
+	})
+}
+
+func (h *handler) GetPromotion(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "promotion id is invalid"})
+		return
+	}
+
+	promotion, err := h.repo.GetPromotion(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get promotion failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get promotion failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": promotion,
+	})
+}
+
+// UpdatePromotion replaces the rule of a promotion, the orders which already
+// used it keep their discount.
+func (h *handler) UpdatePromotion(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "promotion id is invalid"})
+		return
+	}
+
+	promotion, ok := h.bindPromotion(c)
+	if !ok {
+		return
+	}
+	promotion.ID = id
+
+	promotion, err := h.repo.UpdatePromotion(c.Request.Context(), promotion)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	}
+	if errors.Is(err, models.ErrCouponCodeExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Update promotion failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Update promotion failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Updated promotion", zap.Uint("id", id))
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": promotion,
+	})
+}
+
+func (h *handler) DeletePromotion(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "promotion id is invalid"})
+		return
+	}
+
+	err := h.repo.DeletePromotion(c.Request.Context(), id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Delete promotion failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Delete promotion failed"})
+		return
+	}
+
+	h.log(c.Request.Context()).Info("Deleted promotion", zap.Uint("id", id))
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetCartPrice answers the quote of the cart with the promotions, the coupon
+// of the couponCode query and the shipping and the tax of the region query, as
+// checkout would price it.
+func (h *handler) GetCartPrice(c *gin.Context) {
+	customerID, visitorID, ok := cartOwner(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers and visitors have a cart"})
+		return
+	}
+
+	quote, ok := h.priceCart(c, customerID, visitorID, c.Query("couponCode"), c.Query("region"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": quote,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+)
+
+// RegisterRoutes registers the public API on the /api/v1 group. Apart from
+// registration, login, browsing the products and the cart, which anonymous
+// visitors may use, and the payment webhooks, which are signed by the payment
+// gateway, routes require a customer whose role, or an api key whose scopes,
+// have the permission of the route.
+func (h *handler) RegisterRoutes(v1 *gin.RouterGroup) {
+	v1.POST("/customers/register", h.Register)
+	v1.POST("/customers/login", h.Login)
+	v1.POST("/customers/logout", h.Logout)
+	v1.POST("/payments/webhook", h.PaymentWebhook)
+
+	readProducts := v1.Group("", h.AllowVisitors(auth.Permission_ReadProducts)...)
+	readProducts.GET("/products/:id", h.GetProduct)
+	readProducts.GET("/products/seachByName/:name", h.SearchProductByName)
+
+	cart := v1.Group("/cart", h.AllowVisitors(auth.Permission_ManageCart)...)
+	cart.GET("", h.GetCart)
+	cart.GET("/price", h.GetCartPrice)
+	cart.POST("/items", h.AddCartItem)
+	cart.PUT("/items/:product_id", h.UpdateCartItem)
+	cart.DELETE("/items/:product_id", h.RemoveCartItem)
+
+	wishlist := v1.Group("/wishlist", h.Authorize(auth.Permission_ManageWishlist)...)
+	wishlist.GET("", h.GetWishlist)
+	wishlist.POST("/items", h.AddWishlistItem)
+	wishlist.DELETE("/items/:product_id", h.RemoveWishlistItem)
+
+	inbox := v1.Group("/inbox", h.Authorize(auth.Permission_ReadInbox)...)
+	inbox.GET("", h.GetNotifications)
+	inbox.POST("/:id/read", h.ReadNotification)
+
+	orders := v1.Group("/orders", h.Authorize(auth.Permission_PlaceOrders)...)
+	orders.POST("/checkout", h.Checkout)
+	orders.GET("", h.GetOrders)
+	orders.GET("/:id", h.GetOrder)
+	orders.POST("/:id/cancel", h.CancelOrder)
+	orders.POST("/:id/pay", h.PayOrder)
+
+	readOrders := v1.Group("/admin/orders", h.Authorize(auth.Permission_ReadOrders)...)
+	readOrders.GET("", h.GetAllOrders)
+
+	manageOrders := v1.Group("/admin/orders", h.Authorize(auth.Permission_ManageOrders)...)
+	manageOrders.PUT("/:id/status", h.UpdateOrderStatus)
+
+	managePromotions := v1.Group("/admin/promotions", h.Authorize(auth.Permission_ManagePromotions)...)
+	managePromotions.POST("", h.CreatePromotion)
+	managePromotions.GET("", h.GetPromotions)
+	managePromotions.GET("/:id", h.GetPromotion)
+	managePromotions.PUT("/:id", h.UpdatePromotion)
+	managePromotions.DELETE("/:id", h.DeletePromotion)
+
+	writeProducts := v1.Group("", h.Authorize(auth.Permission_WriteProducts)...)
+	writeProducts.POST("/products", h.CreateProduct)
+	writeProducts.PUT("/products/:id", h.UpdateProduct)
+
+	activities := v1.Group("", h.Authorize(auth.Permission_ReadActivities)...)
+	activities.GET("/customer_activities/:id", h.GetCustomerActivites)
+	activities.GET("/customer_activities/:id/actions/:action_type", h.GetCustomerActivitesByAction)
+
+	apiKeys := v1.Group("/api_keys", h.Authorize(auth.Permission_ManageAPIKeys)...)
+	apiKeys.POST("", h.CreateAPIKey)
+	apiKeys.GET("", h.GetAPIKeys)
+	apiKeys.POST("/:id/rotate", h.RotateAPIKey)
+	apiKeys.DELETE("/:id", h.RevokeAPIKey)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type UpdateProductRequest struct {
+	Name     string `binding:"required"`
+	Category string `binding:"max=50"`
+	Price    uint
+	Weight   uint
+}
+
+// UpdateProduct replaces the product. Lowering its price publishes a price
+// drop, the consumer notifies the customers having it in their wishlist.
+func (h *handler) UpdateProduct(c *gin.Context) {
+	id := cast.ToUint(c.Param("id"))
+	if id == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "product id is invalid"})
+		return
+	}
+
+	productInfo := &UpdateProductRequest{}
+	if err := c.ShouldBindJSON(productInfo); err != nil {
+		h.log(c.Request.Context()).Error("Parsed product info failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, priceDrop, err := h.repo.UpdateProduct(c.Request.Context(), &models.Product{
+		ID:       id,
+		Name:     productInfo.Name,
+		Category: productInfo.Category,
+		Price:    productInfo.Price,
+		Weight:   productInfo.Weight,
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Update product failed", zap.Error(err), zap.Uint("id", id))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Update product failed"})
+		return
+	}
+
+	if priceDrop != nil {
+		h.log(c.Request.Context()).Info("Published price drop", zap.Uint("product_id", product.ID), zap.Uint64("outbox_id", priceDrop.ID))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": product,
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/auth"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type AddWishlistItemRequest struct {
+	ProductID uint `binding:"required"`
+}
+
+func (h *handler) GetWishlist(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have a wishlist"})
+		return
+	}
+
+	h.respondWishlist(c, customerID)
+}
+
+// AddWishlistItem saves the product in the wishlist, saving it again changes
+// nothing.
+func (h *handler) AddWishlistItem(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have a wishlist"})
+		return
+	}
+
+	req := &AddWishlistItemRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		h.log(c.Request.Context()).Error("Parsed wishlist item failed", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.repo.GetProductByID(c.Request.Context(), req.ProductID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get product failed", zap.Error(err), zap.Uint("product_id", req.ProductID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Add wishlist item failed"})
+		return
+	}
+
+	if err := h.repo.AddWishlistItem(c.Request.Context(), customerID, req.ProductID); err != nil {
+		h.log(c.Request.Context()).Error("Add wishlist item failed", zap.Error(err), zap.Uint("product_id", req.ProductID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Add wishlist item failed"})
+		return
+	}
+
+	h.respondWishlist(c, customerID)
+}
+
+func (h *handler) RemoveWishlistItem(c *gin.Context) {
+	customerID, ok := auth.CustomerID(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only customers have a wishlist"})
+		return
+	}
+
+	productID := cast.ToUint(c.Param("product_id"))
+	if productID == 0 {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "product id is invalid"})
+		return
+	}
+
+	err := h.repo.RemoveWishlistItem(c.Request.Context(), customerID, productID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product is not in the wishlist"})
+		return
+	}
+	if err != nil {
+		h.log(c.Request.Context()).Error("Remove wishlist item failed", zap.Error(err), zap.Uint("product_id", productID))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Remove wishlist item failed"})
+		return
+	}
+
+	h.respondWishlist(c, customerID)
+}
+
+// respondWishlist answers the wishlist of the customer with the current name
+// and price of its products.
+func (h *handler) respondWishlist(c *gin.Context, customerID uint) {
+	lines, err := h.repo.GetWishlist(c.Request.Context(), customerID)
+	if err != nil {
+		h.log(c.Request.Context()).Error("Get wishlist failed", zap.Error(err))
+		c.JSON(errorStatus(err, http.StatusInternalServerError), gin.H{"error": "Get wishlist failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lines,
+	})
+}
@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrDraining = errors.New("server is draining")
+)
+
+var (
+	defaultCheckTimeout = 2 * time.Second
+)
+
+var (
+	Status_Up   = "UP"
+	Status_Down = "DOWN"
+)
+
+// Checker reports whether a dependency is usable, a nil error means it is.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to the Checker interface.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type ComponentReport struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+type Report struct {
+	Status     string            `json:"status"`
+	Draining   bool              `json:"draining"`
+	Components []ComponentReport `json:"components"`
+}
+
+type component struct {
+	name    string
+	checker Checker
+}
+
+// Health serves the liveness and readiness endpoints of a process. Readiness
+// checks every registered component and fails while the process is draining,
+// so load balancers stop routing traffic before the server shuts down.
+type Health struct {
+	logger     *zap.Logger
+	components []component
+	draining   int32
+	timeout    time.Duration
+}
+
+func New(logger *zap.Logger) *Health {
+	timeout := viper.GetDuration("setting.health_check_timeout")
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	return &Health{
+		logger:  logger,
+		timeout: timeout,
+	}
+}
+
+// Register adds a component to the readiness report. It must be called before
+// the endpoints are served.
+func (h *Health) Register(name string, checker Checker) {
+	h.components = append(h.components, component{name: name, checker: checker})
+}
+
+// SetDraining makes readiness fail from now on.
+func (h *Health) SetDraining() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *Health) IsDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// Liveness reports that the process is running, it does not check any
+// dependency so a broken dependency does not get the process restarted.
+func (h *Health) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": Status_Up,
+	})
+}
+
+// Readiness checks every component concurrently and answers 503 when one of
+// them is down or the process is draining.
+func (h *Health) Readiness(c *gin.Context) {
+	report := h.Check(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != Status_Up {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, report)
+}
+
+func (h *Health) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := Report{
+		Status:     Status_Up,
+		Draining:   h.IsDraining(),
+		Components: make([]ComponentReport, len(h.components)),
+	}
+
+	var wg sync.WaitGroup
+	for i, comp := range h.components {
+		wg.Add(1)
+		go func(i int, comp component) {
+			defer wg.Done()
+			report.Components[i] = h.checkComponent(ctx, comp)
+		}(i, comp)
+	}
+	wg.Wait()
+
+	if report.Draining {
+		report.Status = Status_Down
+	}
+	for _, comp := range report.Components {
+		if comp.Status != Status_Up {
+			report.Status = Status_Down
+		}
+	}
+
+	return report
+}
+
+// checkComponent runs the check in its own goroutine, so a checker which does
+// not honor ctx cannot hold the report past the timeout.
+func (h *Health) checkComponent(ctx context.Context, comp component) ComponentReport {
+	started := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- comp.checker.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	report := ComponentReport{
+		Name:      comp.name,
+		Status:    Status_Up,
+		LatencyMs: float64(time.Since(started)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		h.logger.Warn("Health check failed", zap.String("component", comp.name), zap.Error(err))
+		report.Status = Status_Down
+		report.Error = err.Error()
+	}
+
+	return report
+}
@@ -0,0 +1,79 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/health"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReadiness(t *testing.T) {
+	up := health.CheckerFunc(func(ctx context.Context) error { return nil })
+	down := health.CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") })
+	hanging := health.CheckerFunc(func(ctx context.Context) error { select {} })
+
+	tests := map[string]struct {
+		components     map[string]health.Checker
+		draining       bool
+		expectedStatus int
+		expectedReport map[string]string
+	}{
+		"all components up": {
+			components:     map[string]health.Checker{"mysql": up, "publisher": up},
+			expectedStatus: http.StatusOK,
+			expectedReport: map[string]string{"mysql": health.Status_Up, "publisher": health.Status_Up},
+		},
+		"one component down": {
+			components:     map[string]health.Checker{"mysql": up, "publisher": down},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: map[string]string{"mysql": health.Status_Up, "publisher": health.Status_Down},
+		},
+		"component times out": {
+			components:     map[string]health.Checker{"consumer": hanging},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: map[string]string{"consumer": health.Status_Down},
+		},
+		"draining": {
+			components:     map[string]health.Checker{"mysql": up},
+			draining:       true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: map[string]string{"mysql": health.Status_Up},
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			healthz := health.New(zap.NewNop())
+			for name, checker := range test.components {
+				healthz.Register(name, checker)
+			}
+			if test.draining {
+				healthz.SetDraining()
+			}
+
+			router := gin.New()
+			router.GET("/readyz", healthz.Readiness)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, test.expectedStatus, recorder.Code)
+
+			report := health.Report{}
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+			assert.Equal(t, test.draining, report.Draining)
+			components := make(map[string]string)
+			for _, component := range report.Components {
+				components[component.Name] = component.Status
+			}
+			assert.Equal(t, test.expectedReport, components)
+		})
+	}
+}
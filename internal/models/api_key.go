@@ -0,0 +1,18 @@
+package models
+
+// APIKey authenticates a partner system. Only the SHA-256 hash of the key is
+// stored, Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID        uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name      string   `gorm:"type:varchar(100)" json:"name"`
+	Prefix    string   `gorm:"type:varchar(16)" json:"prefix"`
+	Hash      string   `gorm:"type:char(64);uniqueIndex" json:"-"`
+	Scopes    []string `gorm:"type:text;serializer:json" json:"scopes"`
+	CreatedBy uint     `json:"createdBy"`
+	CreatedAt int64    `json:"createdAt"`
+	RevokedAt int64    `json:"revokedAt,omitempty"`
+}
+
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != 0
+}
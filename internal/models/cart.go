@@ -0,0 +1,45 @@
+package models
+
+// CartItem is a product in the cart of a customer or, when CustomerID is 0, of
+// an anonymous visitor.
+type CartItem struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	CustomerID uint   `gorm:"uniqueIndex:idx_cart_item" json:"-"`
+	VisitorID  string `gorm:"type:varchar(32);uniqueIndex:idx_cart_item" json:"-"`
+	ProductID  uint   `gorm:"uniqueIndex:idx_cart_item" json:"productId"`
+	Quantity   uint   `json:"quantity"`
+	CreatedAt  int64  `json:"createdAt"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+// CartLine is a cart item priced with the current price of its product.
+type CartLine struct {
+	ProductID uint   `json:"productId"`
+	Name      string `json:"name"`
+	Category  string `json:"category,omitempty"`
+	Price     uint   `json:"price"`
+	Weight    uint   `json:"weight,omitempty"`
+	Quantity  uint   `json:"quantity"`
+	Subtotal  uint   `json:"subtotal"`
+}
+
+// Cart is the content of a cart and its totals.
+type Cart struct {
+	Items         []*CartLine `json:"items"`
+	TotalQuantity uint        `json:"totalQuantity"`
+	Total         uint        `json:"total"`
+}
+
+// NewCart computes the subtotal of every line and the totals of the cart.
+func NewCart(lines []*CartLine) *Cart {
+	cart := &Cart{Items: lines}
+	if cart.Items == nil {
+		cart.Items = []*CartLine{}
+	}
+	for _, line := range cart.Items {
+		line.Subtotal = line.Price * line.Quantity
+		cart.TotalQuantity += line.Quantity
+		cart.Total += line.Subtotal
+	}
+	return cart
+}
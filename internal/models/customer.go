@@ -0,0 +1,23 @@
+package models
+
+import "errors"
+
+var (
+	ErrCustomerExists = errors.New("customer already exists")
+)
+
+type Customer struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email        string `gorm:"type:varchar(255);uniqueIndex" json:"email"`
+	Name         string `gorm:"type:varchar(100)" json:"name"`
+	PasswordHash string `gorm:"type:varchar(100)" json:"-"`
+	Role         string `gorm:"type:varchar(20);default:CUSTOMER" json:"role"`
+	CreatedAt    int64  `json:"createdAt"`
+}
+
+var (
+	Role_Admin        = "ADMIN"
+	Role_Merchandiser = "MERCHANDISER"
+	Role_Support      = "SUPPORT"
+	Role_Customer     = "CUSTOMER"
+)
@@ -1,13 +1,47 @@
 package models
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// CustomerActivity is an activity of a customer. EventID identifies the event
+// which recorded it, an event delivered more than once is stored once.
 type CustomerActivity struct {
-	UserID    uint   `gorm:"primaryKey"`
-	CreatedAt int64  `gorm:"primaryKey"`
+	ID        uint64 `gorm:"primaryKey;autoIncrement" json:"-"`
+	EventID   string `gorm:"type:varchar(64);uniqueIndex" json:",omitempty"`
+	UserID    uint   `gorm:"index:idx_customer_activities_user_created,priority:1"`
+	CreatedAt int64  `gorm:"index:idx_customer_activities_user_created,priority:2"`
 	Action    string `gorm:"type:varchar(20);index"`
 	Data      string `gorm:"type:text"`
+	// VisitorID is set on the activities of anonymous visitors, whose UserID
+	// is 0. It is carried by the events only, the activities are stored in
+	// visitor_activities until the visitor logs in.
+	VisitorID string `gorm:"-" json:",omitempty"`
 }
 
 var (
-	CustomAction_ViewProduct   = "VIEW_PRODUCT"
-	CustomAction_SearchProduct = "SEARCH_PRODUCT"
+	CustomAction_ViewProduct     = "VIEW_PRODUCT"
+	CustomAction_SearchProduct   = "SEARCH_PRODUCT"
+	CustomAction_IdentifyVisitor = "IDENTIFY_VISITOR"
+	CustomAction_AddToCart       = "ADD_TO_CART"
+	CustomAction_RemoveFromCart  = "REMOVE_FROM_CART"
+	CustomAction_PriceDropped    = "PRICE_DROPPED"
 )
+
+// IsCustomAction reports whether action is one of the CustomAction_ values.
+func IsCustomAction(action string) bool {
+	switch action {
+	case CustomAction_ViewProduct, CustomAction_SearchProduct, CustomAction_IdentifyVisitor,
+		CustomAction_AddToCart, CustomAction_RemoveFromCart, CustomAction_PriceDropped:
+		return true
+	}
+	return false
+}
+
+// NewEventID returns the id of a new activity event.
+func NewEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Notification is a message in the inbox of a customer. The unique index
+// makes the notification of an event idempotent, an event redelivered or
+// replayed notifies every customer once.
+type Notification struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID uint   `gorm:"uniqueIndex:idx_notification" json:"-"`
+	Type       string `gorm:"type:varchar(20);uniqueIndex:idx_notification" json:"type"`
+	ProductID  uint   `gorm:"uniqueIndex:idx_notification" json:"productId,omitempty"`
+	Message    string `gorm:"type:varchar(255)" json:"message"`
+	OldPrice   uint   `json:"oldPrice,omitempty"`
+	NewPrice   uint   `json:"newPrice,omitempty"`
+	CreatedAt  int64  `gorm:"uniqueIndex:idx_notification" json:"createdAt"`
+	ReadAt     int64  `json:"readAt,omitempty"`
+}
+
+var (
+	NotificationType_PriceDropped = "PRICE_DROPPED"
+)
+
+// PriceDrop is the data of the PRICE_DROPPED events, published when the price
+// of a product is lowered.
+type PriceDrop struct {
+	ProductID uint   `json:"productId"`
+	Name      string `json:"name"`
+	OldPrice  uint   `json:"oldPrice"`
+	NewPrice  uint   `json:"newPrice"`
+}
+
+// Activity returns the PRICE_DROPPED event of the drop made at droppedAt.
+func (d *PriceDrop) Activity(droppedAt int64) *CustomerActivity {
+	data, _ := json.Marshal(d)
+	return &CustomerActivity{
+		EventID:   NewEventID(),
+		CreatedAt: droppedAt,
+		Action:    CustomAction_PriceDropped,
+		Data:      string(data),
+	}
+}
+
+// Notification returns the notification of the price drop for the customer,
+// droppedAt is when the price was lowered.
+func (d *PriceDrop) Notification(customerID uint, droppedAt int64) *Notification {
+	return &Notification{
+		CustomerID: customerID,
+		Type:       NotificationType_PriceDropped,
+		ProductID:  d.ProductID,
+		Message:    fmt.Sprintf("%s in your wishlist dropped from %d to %d", d.Name, d.OldPrice, d.NewPrice),
+		OldPrice:   d.OldPrice,
+		NewPrice:   d.NewPrice,
+		CreatedAt:  droppedAt,
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import "errors"
+
+var (
+	ErrEmptyCart         = errors.New("cart is empty")
+	ErrInvalidTransition = errors.New("order status cannot change to the requested status")
+	ErrPaymentMismatch   = errors.New("order is paid with another payment intent")
+)
+
+// Order is a checked out cart. The items keep the name and the price the
+// products had at checkout, later changes of the products do not change the
+// order. Total is the Subtotal of the items less the Discount of the
+// promotions applied at checkout, plus the Shipping and the Tax of the Region
+// the order ships to. PaymentIntentID is the payment of the order at the
+// payment gateway.
+type Order struct {
+	ID              uint         `gorm:"primaryKey;autoIncrement" json:"id"`
+	CustomerID      uint         `gorm:"index" json:"customerId"`
+	Status          string       `gorm:"type:varchar(20);index" json:"status"`
+	Subtotal        uint         `json:"subtotal"`
+	Discount        uint         `json:"discount"`
+	Region          string       `gorm:"type:varchar(10)" json:"region,omitempty"`
+	Shipping        uint         `json:"shipping"`
+	Tax             uint         `json:"tax"`
+	Total           uint         `json:"total"`
+	CouponCode      string       `gorm:"type:varchar(32)" json:"couponCode,omitempty"`
+	PaymentIntentID string       `gorm:"type:varchar(64);index" json:"paymentIntentId,omitempty"`
+	Items           []*OrderItem `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+	CreatedAt       int64        `json:"createdAt"`
+	UpdatedAt       int64        `json:"updatedAt"`
+}
+
+type OrderItem struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	OrderID   uint   `gorm:"index" json:"-"`
+	ProductID uint   `json:"productId"`
+	Name      string `gorm:"type:varchar(100)" json:"name"`
+	Price     uint   `json:"price"`
+	Quantity  uint   `json:"quantity"`
+	Subtotal  uint   `json:"subtotal"`
+}
+
+var (
+	OrderStatus_Pending   = "PENDING"
+	OrderStatus_Paid      = "PAID"
+	OrderStatus_Shipped   = "SHIPPED"
+	OrderStatus_Delivered = "DELIVERED"
+	OrderStatus_Cancelled = "CANCELLED"
+	OrderStatus_Refunded  = "REFUNDED"
+)
+
+// orderTransitions lists the statuses an order can move to from every status.
+// Cancelled and refunded orders are final.
+var orderTransitions = map[string][]string{
+	OrderStatus_Pending:   {OrderStatus_Paid, OrderStatus_Cancelled},
+	OrderStatus_Paid:      {OrderStatus_Shipped, OrderStatus_Refunded},
+	OrderStatus_Shipped:   {OrderStatus_Delivered},
+	OrderStatus_Delivered: {OrderStatus_Refunded},
+	OrderStatus_Cancelled: {},
+	OrderStatus_Refunded:  {},
+}
+
+// IsOrderStatus reports whether status is one of the OrderStatus_ values.
+func IsOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether the order can move to status.
+func (o *Order) CanTransition(status string) bool {
+	for _, next := range orderTransitions[o.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the order to status, or returns ErrInvalidTransition.
+func (o *Order) Transition(status string) error {
+	if !o.CanTransition(status) {
+		return ErrInvalidTransition
+	}
+	o.Status = status
+	return nil
+}
+
+// ApplyPayment moves the order to status on behalf of the payment intentID.
+// Applying a payment the order already reflects does nothing, so retried
+// requests and redelivered webhooks succeed. It returns ErrPaymentMismatch
+// when the order is paid with another intent.
+func (o *Order) ApplyPayment(intentID, status string) error {
+	if o.PaymentIntentID != "" && o.PaymentIntentID != intentID {
+		return ErrPaymentMismatch
+	}
+	if o.PaymentIntentID == intentID && o.Status == status {
+		return nil
+	}
+	if err := o.Transition(status); err != nil {
+		return err
+	}
+	o.PaymentIntentID = intentID
+	return nil
+}
@@ -0,0 +1,134 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderTransition(t *testing.T) {
+	tests := map[string]struct {
+		from          string
+		to            string
+		expectedError error
+	}{
+		"pending order is paid": {
+			from: models.OrderStatus_Pending,
+			to:   models.OrderStatus_Paid,
+		},
+		"pending order is cancelled": {
+			from: models.OrderStatus_Pending,
+			to:   models.OrderStatus_Cancelled,
+		},
+		"pending order cannot ship": {
+			from:          models.OrderStatus_Pending,
+			to:            models.OrderStatus_Shipped,
+			expectedError: models.ErrInvalidTransition,
+		},
+		"paid order ships": {
+			from: models.OrderStatus_Paid,
+			to:   models.OrderStatus_Shipped,
+		},
+		"paid order is refunded": {
+			from: models.OrderStatus_Paid,
+			to:   models.OrderStatus_Refunded,
+		},
+		"paid order cannot be cancelled": {
+			from:          models.OrderStatus_Paid,
+			to:            models.OrderStatus_Cancelled,
+			expectedError: models.ErrInvalidTransition,
+		},
+		"shipped order is delivered": {
+			from: models.OrderStatus_Shipped,
+			to:   models.OrderStatus_Delivered,
+		},
+		"delivered order is refunded": {
+			from: models.OrderStatus_Delivered,
+			to:   models.OrderStatus_Refunded,
+		},
+		"cancelled order is final": {
+			from:          models.OrderStatus_Cancelled,
+			to:            models.OrderStatus_Paid,
+			expectedError: models.ErrInvalidTransition,
+		},
+		"refunded order is final": {
+			from:          models.OrderStatus_Refunded,
+			to:            models.OrderStatus_Shipped,
+			expectedError: models.ErrInvalidTransition,
+		},
+		"unknown status": {
+			from:          models.OrderStatus_Pending,
+			to:            "LOST",
+			expectedError: models.ErrInvalidTransition,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			order := &models.Order{Status: test.from}
+			err := order.Transition(test.to)
+			assert.Equal(t, test.expectedError, err)
+			if err == nil {
+				assert.Equal(t, test.to, order.Status)
+			} else {
+				assert.Equal(t, test.from, order.Status)
+			}
+		})
+	}
+}
+
+func TestOrderApplyPayment(t *testing.T) {
+	tests := map[string]struct {
+		order          models.Order
+		intentID       string
+		status         string
+		expectedStatus string
+		expectedError  error
+	}{
+		"pending order is paid": {
+			order:          models.Order{Status: models.OrderStatus_Pending},
+			intentID:       "pi_1",
+			status:         models.OrderStatus_Paid,
+			expectedStatus: models.OrderStatus_Paid,
+		},
+		"payment applied again": {
+			order:          models.Order{Status: models.OrderStatus_Paid, PaymentIntentID: "pi_1"},
+			intentID:       "pi_1",
+			status:         models.OrderStatus_Paid,
+			expectedStatus: models.OrderStatus_Paid,
+		},
+		"paid order is refunded": {
+			order:          models.Order{Status: models.OrderStatus_Paid, PaymentIntentID: "pi_1"},
+			intentID:       "pi_1",
+			status:         models.OrderStatus_Refunded,
+			expectedStatus: models.OrderStatus_Refunded,
+		},
+		"order paid with another intent": {
+			order:          models.Order{Status: models.OrderStatus_Paid, PaymentIntentID: "pi_1"},
+			intentID:       "pi_2",
+			status:         models.OrderStatus_Paid,
+			expectedStatus: models.OrderStatus_Paid,
+			expectedError:  models.ErrPaymentMismatch,
+		},
+		"cancelled order cannot be paid": {
+			order:          models.Order{Status: models.OrderStatus_Cancelled},
+			intentID:       "pi_1",
+			status:         models.OrderStatus_Paid,
+			expectedStatus: models.OrderStatus_Cancelled,
+			expectedError:  models.ErrInvalidTransition,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			order := test.order
+			err := order.ApplyPayment(test.intentID, test.status)
+			assert.Equal(t, test.expectedError, err)
+			assert.Equal(t, test.expectedStatus, order.Status)
+			if err == nil {
+				assert.Equal(t, test.intentID, order.PaymentIntentID)
+			}
+		})
+	}
+}
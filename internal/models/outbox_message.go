@@ -0,0 +1,22 @@
+package models
+
+type OutboxMessage struct {
+	ID      uint64 `gorm:"primaryKey;autoIncrement"`
+	Topic   string `gorm:"type:varchar(100)"`
+	Key     string `gorm:"type:varchar(64)"`
+	Payload string `gorm:"type:text"`
+	// Headers carry the trace context of the request which wrote the message
+	Headers       map[string]string `gorm:"type:text;serializer:json"`
+	Status        string            `gorm:"type:varchar(10);index:idx_outbox_status_next_attempt,priority:1"`
+	Attempts      uint
+	LastError     string `gorm:"type:text"`
+	NextAttemptAt int64  `gorm:"index:idx_outbox_status_next_attempt,priority:2"`
+	CreatedAt     int64
+	SentAt        int64
+}
+
+var (
+	OutboxStatus_Pending = "PENDING"
+	OutboxStatus_Sent    = "SENT"
+	OutboxStatus_Failed  = "FAILED"
+)
@@ -3,6 +3,8 @@ package models
 type Product struct {
 	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name      string `gorm:"type:varchar(100);index:,class:FULLTEXT,option:WITH PARSER ngram" json:"name"`
+	Category  string `gorm:"type:varchar(50);index" json:"category,omitempty"`
 	Price     uint   `json:"price"`
+	Weight    uint   `json:"weight,omitempty"` // grams
 	CreatedAt int64  `json:"createdAt"`
 }
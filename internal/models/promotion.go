@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPromotion    = errors.New("promotion is invalid")
+	ErrCouponCodeExists    = errors.New("coupon code already exists")
+	ErrPromotionNotStarted = errors.New("promotion is not valid yet")
+	ErrPromotionExpired    = errors.New("promotion is expired")
+	ErrPromotionUsedUp     = errors.New("promotion reached its usage limit")
+)
+
+// Promotion is a discount rule. Promotions without a Code apply to every cart
+// they match, the others are coupons the customer enters. Only the products of
+// Category count towards the promotion when it is set. StartsAt and EndsAt
+// bound when the promotion is valid, 0 leaves that side open, and UsageLimit
+// bounds how many orders may use it, 0 for no limit.
+type Promotion struct {
+	ID   uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name string  `gorm:"type:varchar(100)" json:"name"`
+	Code *string `gorm:"type:varchar(32);uniqueIndex" json:"code,omitempty"`
+	Type string  `gorm:"type:varchar(20)" json:"type"`
+	// Value is the percentage off of PERCENTAGE promotions and the amount off
+	// of FIXED_AMOUNT promotions
+	Value uint `json:"value,omitempty"`
+	// every BuyQuantity + GetQuantity products of BUY_X_GET_Y promotions, the
+	// GetQuantity cheapest ones are free
+	BuyQuantity uint   `json:"buyQuantity,omitempty"`
+	GetQuantity uint   `json:"getQuantity,omitempty"`
+	Category    string `gorm:"type:varchar(50)" json:"category,omitempty"`
+	// MinSubtotal is the subtotal the products of the promotion must reach
+	MinSubtotal uint  `json:"minSubtotal,omitempty"`
+	UsageLimit  uint  `json:"usageLimit,omitempty"`
+	UsageCount  uint  `json:"usageCount"`
+	StartsAt    int64 `json:"startsAt,omitempty"`
+	EndsAt      int64 `json:"endsAt,omitempty"`
+	CreatedAt   int64 `json:"createdAt"`
+	UpdatedAt   int64 `json:"updatedAt"`
+}
+
+var (
+	PromotionType_Percentage  = "PERCENTAGE"
+	PromotionType_FixedAmount = "FIXED_AMOUNT"
+	PromotionType_BuyXGetY    = "BUY_X_GET_Y"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// NormalizeCouponCode makes coupon codes case insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsCoupon reports whether the promotion only applies when its code is
+// entered.
+func (p *Promotion) IsCoupon() bool {
+	return p.Code != nil
+}
+
+// Validate checks the rule of the promotion is complete and consistent.
+func (p *Promotion) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidPromotion)
+	}
+	if p.Code != nil && !couponCodePattern.MatchString(*p.Code) {
+		return fmt.Errorf("%w: code must be 3 to 32 letters, digits, - or _", ErrInvalidPromotion)
+	}
+
+	switch p.Type {
+	case PromotionType_Percentage:
+		if p.Value == 0 || p.Value > 100 {
+			return fmt.Errorf("%w: percentage must be between 1 and 100", ErrInvalidPromotion)
+		}
+	case PromotionType_FixedAmount:
+		if p.Value == 0 {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidPromotion)
+		}
+	case PromotionType_BuyXGetY:
+		if p.BuyQuantity == 0 || p.GetQuantity == 0 {
+			return fmt.Errorf("%w: buy and get quantities must be positive", ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPromotion, p.Type)
+	}
+
+	if p.EndsAt != 0 && p.EndsAt <= p.StartsAt {
+		return fmt.Errorf("%w: promotion must end after it starts", ErrInvalidPromotion)
+	}
+	return nil
+}
+
+// Check returns why the promotion cannot be used at now, or nil.
+func (p *Promotion) Check(now time.Time) error {
+	at := now.UnixMilli()
+	switch {
+	case p.StartsAt != 0 && at < p.StartsAt:
+		return ErrPromotionNotStarted
+	case p.EndsAt != 0 && at >= p.EndsAt:
+		return ErrPromotionExpired
+	case p.UsageLimit != 0 && p.UsageCount >= p.UsageLimit:
+		return ErrPromotionUsedUp
+	}
+	return nil
+}
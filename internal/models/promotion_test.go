@@ -0,0 +1,96 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromotionValidate(t *testing.T) {
+	code := func(c string) *string { return &c }
+
+	tests := map[string]struct {
+		promotion models.Promotion
+		valid     bool
+	}{
+		"percentage": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_Percentage, Value: 100},
+			valid:     true,
+		},
+		"percentage above 100": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_Percentage, Value: 101},
+		},
+		"fixed amount": {
+			promotion: models.Promotion{Name: "Sale", Code: code("SAVE-10"), Type: models.PromotionType_FixedAmount, Value: 10},
+			valid:     true,
+		},
+		"fixed amount of zero": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_FixedAmount},
+		},
+		"buy x get y": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			valid:     true,
+		},
+		"buy x get nothing": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2},
+		},
+		"unknown type": {
+			promotion: models.Promotion{Name: "Sale", Type: "FREE_LUNCH", Value: 10},
+		},
+		"no name": {
+			promotion: models.Promotion{Type: models.PromotionType_Percentage, Value: 10},
+		},
+		"code with spaces": {
+			promotion: models.Promotion{Name: "Sale", Code: code("SAVE 10"), Type: models.PromotionType_Percentage, Value: 10},
+		},
+		"ends before it starts": {
+			promotion: models.Promotion{Name: "Sale", Type: models.PromotionType_Percentage, Value: 10, StartsAt: 2000, EndsAt: 1000},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.promotion.Validate()
+			if test.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, models.ErrInvalidPromotion), err)
+			}
+		})
+	}
+}
+
+func TestPromotionCheck(t *testing.T) {
+	now := time.Now()
+
+	tests := map[string]struct {
+		promotion     models.Promotion
+		expectedError error
+	}{
+		"open": {},
+		"running": {
+			promotion: models.Promotion{StartsAt: now.UnixMilli(), EndsAt: now.Add(time.Hour).UnixMilli()},
+		},
+		"not started": {
+			promotion:     models.Promotion{StartsAt: now.Add(time.Hour).UnixMilli()},
+			expectedError: models.ErrPromotionNotStarted,
+		},
+		"expired": {
+			promotion:     models.Promotion{EndsAt: now.UnixMilli()},
+			expectedError: models.ErrPromotionExpired,
+		},
+		"used up": {
+			promotion:     models.Promotion{UsageLimit: 3, UsageCount: 3},
+			expectedError: models.ErrPromotionUsedUp,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expectedError, test.promotion.Check(now))
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+// Visitor is an anonymous visitor, identified by the visitor cookie. CustomerID
+// is set once the visitor logged in.
+type Visitor struct {
+	ID           string `gorm:"type:varchar(32);primaryKey"`
+	CustomerID   uint   `gorm:"index"`
+	IdentifiedAt int64
+}
+
+// VisitorActivity is an activity of a visitor who has not logged in yet.
+type VisitorActivity struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	EventID   string `gorm:"type:varchar(64);uniqueIndex"`
+	VisitorID string `gorm:"type:varchar(32);index"`
+	CreatedAt int64
+	Action    string `gorm:"type:varchar(20)"`
+	Data      string `gorm:"type:text"`
+}
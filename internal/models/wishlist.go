@@ -0,0 +1,18 @@
+package models
+
+// WishlistItem is a product a customer saved for later.
+type WishlistItem struct {
+	ID         uint  `gorm:"primaryKey;autoIncrement" json:"-"`
+	CustomerID uint  `gorm:"uniqueIndex:idx_wishlist_item" json:"-"`
+	ProductID  uint  `gorm:"uniqueIndex:idx_wishlist_item;index" json:"productId"`
+	CreatedAt  int64 `json:"createdAt"`
+}
+
+// WishlistLine is a wishlist item with the current name and price of its
+// product.
+type WishlistLine struct {
+	ProductID uint   `json:"productId"`
+	Name      string `json:"name"`
+	Price     uint   `json:"price"`
+	CreatedAt int64  `json:"createdAt"`
+}
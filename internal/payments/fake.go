@@ -0,0 +1,106 @@
+package payments
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// PaymentMethod_Decline is declined by the fake gateway, every other payment
+// method is approved.
+var PaymentMethod_Decline = "tok_decline"
+
+// FakeGateway is an in-memory Gateway for local development and tests. It is
+// deterministic: the id of an intent is derived from its idempotency key and
+// only PaymentMethod_Decline is declined. Intents are lost when the process
+// exits.
+type FakeGateway struct {
+	*webhooks
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+}
+
+func NewFakeGateway() (*FakeGateway, error) {
+	webhooks, err := newWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FakeGateway{
+		webhooks: webhooks,
+		intents:  make(map[string]*Intent),
+	}, nil
+}
+
+// Authorize returns the intent already authorized with the idempotency key of
+// req, unless its amount differs. Declined payments create no intent, they can
+// be retried with another payment method under the same key.
+func (g *FakeGateway) Authorize(ctx context.Context, req *AuthorizeRequest) (*Intent, error) {
+	if req.IdempotencyKey == "" || req.Amount == 0 || req.PaymentMethod == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := deterministicID("pi_", req.IdempotencyKey)
+	if intent, ok := g.intents[id]; ok {
+		if intent.Amount != req.Amount || intent.Reference != req.Reference {
+			return nil, ErrIdempotencyConflict
+		}
+		return copyIntent(intent), nil
+	}
+	if req.PaymentMethod == PaymentMethod_Decline {
+		return nil, ErrDeclined
+	}
+
+	intent := &Intent{
+		ID:        id,
+		Reference: req.Reference,
+		Amount:    req.Amount,
+		Status:    IntentStatus_Authorized,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	g.intents[id] = intent
+
+	return copyIntent(intent), nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	return g.transition(intentID, IntentStatus_Authorized, IntentStatus_Captured)
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, intentID string) (*Intent, error) {
+	return g.transition(intentID, IntentStatus_Captured, IntentStatus_Refunded)
+}
+
+func (g *FakeGateway) Check(ctx context.Context) error {
+	return nil
+}
+
+// transition moves the intent from status from to status to, an intent
+// already in status to is returned as is.
+func (g *FakeGateway) transition(intentID, from, to string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	intent, ok := g.intents[intentID]
+	if !ok {
+		return nil, ErrIntentNotFound
+	}
+	switch intent.Status {
+	case to:
+	case from:
+		intent.Status = to
+	default:
+		return nil, ErrInvalidState
+	}
+
+	return copyIntent(intent), nil
+}
+
+func copyIntent(intent *Intent) *Intent {
+	copied := *intent
+	return &copied
+}
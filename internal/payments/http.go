@@ -0,0 +1,128 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	defaultHTTPTimeout = 5 * time.Second
+)
+
+// IdempotencyKeyHeader carries the idempotency key of an authorization.
+var IdempotencyKeyHeader = "Idempotency-Key"
+
+// HTTPGateway is a Gateway calling the stub server of the serve-payment-stub
+// command on payments.http.url, so the api talks to its payment provider over
+// the network like it would in production.
+type HTTPGateway struct {
+	*webhooks
+
+	url    string
+	client *http.Client
+}
+
+func NewHTTPGateway() (*HTTPGateway, error) {
+	webhooks, err := newWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimRight(viper.GetString("payments.http.url"), "/")
+	if baseURL == "" {
+		return nil, ErrMissingURL
+	}
+	timeout := viper.GetDuration("payments.http.timeout")
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+
+	return &HTTPGateway{
+		webhooks: webhooks,
+		url:      baseURL,
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (g *HTTPGateway) Authorize(ctx context.Context, req *AuthorizeRequest) (*Intent, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.do(ctx, "/v1/intents", body, req.IdempotencyKey)
+}
+
+func (g *HTTPGateway) Capture(ctx context.Context, intentID string) (*Intent, error) {
+	return g.do(ctx, "/v1/intents/"+url.PathEscape(intentID)+"/capture", nil, "")
+}
+
+func (g *HTTPGateway) Refund(ctx context.Context, intentID string) (*Intent, error) {
+	return g.do(ctx, "/v1/intents/"+url.PathEscape(intentID)+"/refund", nil, "")
+}
+
+func (g *HTTPGateway) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"/v1/ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d", ErrUnexpectedResponse, resp.StatusCode)
+	}
+	return nil
+}
+
+// do posts body to path and returns the intent of the response. Errors the
+// stub server answers with a known code are returned as their sentinel.
+func (g *HTTPGateway) do(ctx context.Context, path string, body []byte, idempotencyKey string) (*Intent, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		failure := &stubError{}
+		if err := json.Unmarshal(payload, failure); err == nil {
+			if err, ok := errorCodes[failure.Code]; ok {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("%w: status %d", ErrUnexpectedResponse, resp.StatusCode)
+	}
+
+	intent := &Intent{}
+	if err := json.Unmarshal(payload, intent); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+	}
+
+	return intent, nil
+}
@@ -0,0 +1,203 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownDriver        = errors.New("unknown payment gateway driver")
+	ErrMissingWebhookSecret = errors.New("payments.webhook_secret is not set")
+	ErrMissingURL           = errors.New("payments.http.url is not set")
+	ErrInvalidRequest       = errors.New("payment request is invalid")
+	ErrDeclined             = errors.New("payment is declined")
+	ErrIntentNotFound       = errors.New("payment intent not found")
+	ErrIdempotencyConflict  = errors.New("idempotency key is used by another payment")
+	ErrInvalidState         = errors.New("payment intent cannot change to the requested status")
+	ErrInvalidSignature     = errors.New("webhook signature is invalid")
+	ErrSignatureExpired     = errors.New("webhook signature is expired")
+	ErrUnexpectedResponse   = errors.New("payment gateway answered unexpectedly")
+)
+
+var (
+	DriverFake = "fake"
+	DriverHTTP = "http"
+)
+
+var (
+	defaultWebhookTolerance = 5 * time.Minute
+)
+
+// SignatureHeader carries the signature of a webhook, t=<unix time>,v1=<hex
+// HMAC-SHA256 of the time, a dot and the payload>.
+var SignatureHeader = "Payment-Signature"
+
+var (
+	IntentStatus_Authorized = "AUTHORIZED"
+	IntentStatus_Captured   = "CAPTURED"
+	IntentStatus_Refunded   = "REFUNDED"
+)
+
+var (
+	EventType_Captured = "payment_intent.captured"
+	EventType_Refunded = "payment_intent.refunded"
+)
+
+// AuthorizeRequest reserves Amount on the payment method. Requests with the
+// same IdempotencyKey authorize once, Reference is the order the payment is
+// for and is sent back in the webhooks.
+type AuthorizeRequest struct {
+	IdempotencyKey string `json:"-"`
+	Reference      string `json:"reference"`
+	Amount         uint   `json:"amount"`
+	PaymentMethod  string `json:"paymentMethod"`
+}
+
+// Intent is a payment at the gateway, it is authorized, then captured and
+// maybe refunded.
+type Intent struct {
+	ID        string `json:"id"`
+	Reference string `json:"reference"`
+	Amount    uint   `json:"amount"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Event is a webhook notification about a change of an intent.
+type Event struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	Intent    *Intent `json:"intent"`
+	CreatedAt int64   `json:"createdAt"`
+}
+
+// Gateway is a payment service provider. Capture and Refund move the whole
+// amount of the intent and are idempotent, calling them again for an intent
+// already in the resulting status returns the intent unchanged.
+type Gateway interface {
+	Authorize(ctx context.Context, req *AuthorizeRequest) (*Intent, error)
+	Capture(ctx context.Context, intentID string) (*Intent, error)
+	Refund(ctx context.Context, intentID string) (*Intent, error)
+	// VerifyWebhook returns the event of a webhook whose signature is valid.
+	VerifyWebhook(payload []byte, signature string) (*Event, error)
+	// Check reports whether the gateway can currently be reached.
+	Check(ctx context.Context) error
+}
+
+// New creates the gateway of the driver configured in payments.driver, the
+// fake gateway is used when it is not set.
+func New(logger *zap.Logger) (Gateway, error) {
+	switch driver := viper.GetString("payments.driver"); driver {
+	case "", DriverFake:
+		return NewFakeGateway()
+	case DriverHTTP:
+		return NewHTTPGateway()
+	default:
+		logger.Error("Payment gateway driver is unknown", zap.String("driver", driver))
+		return nil, ErrUnknownDriver
+	}
+}
+
+// webhooks signs and verifies webhooks with payments.webhook_secret.
+// Signatures older than payments.webhook_tolerance are rejected so captured
+// webhooks cannot be replayed later.
+type webhooks struct {
+	secret    []byte
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+func newWebhooks() (*webhooks, error) {
+	secret := viper.GetString("payments.webhook_secret")
+	if secret == "" {
+		return nil, ErrMissingWebhookSecret
+	}
+	tolerance := viper.GetDuration("payments.webhook_tolerance")
+	if tolerance <= 0 {
+		tolerance = defaultWebhookTolerance
+	}
+
+	return &webhooks{
+		secret:    []byte(secret),
+		tolerance: tolerance,
+		now:       time.Now,
+	}, nil
+}
+
+// SignWebhook returns the payload of the event and its signature.
+func (w *webhooks) SignWebhook(event *Event) ([]byte, string, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	timestamp := strconv.FormatInt(w.now().Unix(), 10)
+
+	return payload, "t=" + timestamp + ",v1=" + w.sign(timestamp, payload), nil
+}
+
+func (w *webhooks) VerifyWebhook(payload []byte, signature string) (*Event, error) {
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		if strings.HasPrefix(part, "t=") {
+			timestamp = strings.TrimPrefix(part, "t=")
+		} else if strings.HasPrefix(part, "v1=") {
+			mac = strings.TrimPrefix(part, "v1=")
+		}
+	}
+	if timestamp == "" || mac == "" {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(mac), []byte(w.sign(timestamp, payload))) {
+		return nil, ErrInvalidSignature
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if age := w.now().Sub(time.Unix(signedAt, 0)); age > w.tolerance || age < -w.tolerance {
+		return nil, ErrSignatureExpired
+	}
+
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); err != nil || event.Intent == nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return event, nil
+}
+
+func (w *webhooks) sign(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewEvent returns the event telling about the current status of the
+// intent, its id is the same every time the intent reaches that status.
+func NewEvent(eventType string, intent *Intent) *Event {
+	return &Event{
+		ID:        deterministicID("evt_", intent.ID+"/"+eventType),
+		Type:      eventType,
+		Intent:    intent,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+}
+
+// deterministicID derives an id from key, the same key always gives the same
+// id.
+func deterministicID(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:12])
+}
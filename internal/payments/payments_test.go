@@ -0,0 +1,162 @@
+package payments_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/payments"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newFakeGateway(t *testing.T) *payments.FakeGateway {
+	viper.Set("payments.webhook_secret", "webhook-secret")
+	t.Cleanup(viper.Reset)
+
+	gateway, err := payments.NewFakeGateway()
+	assert.Nil(t, err)
+	return gateway
+}
+
+// newHTTPGateway returns an HTTPGateway calling a stub server of a fake
+// gateway.
+func newHTTPGateway(t *testing.T) *payments.HTTPGateway {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	payments.NewStubServer(zap.NewNop(), newFakeGateway(t)).RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	viper.Set("payments.http.url", server.URL)
+	gateway, err := payments.NewHTTPGateway()
+	assert.Nil(t, err)
+	return gateway
+}
+
+func TestGateway(t *testing.T) {
+	gateways := map[string]func(t *testing.T) payments.Gateway{
+		"fake": func(t *testing.T) payments.Gateway { return newFakeGateway(t) },
+		"http": func(t *testing.T) payments.Gateway { return newHTTPGateway(t) },
+	}
+
+	for name, newGateway := range gateways {
+		t.Run(name, func(t *testing.T) {
+			gateway := newGateway(t)
+			ctx := context.Background()
+			req := &payments.AuthorizeRequest{
+				IdempotencyKey: "order-1",
+				Reference:      "1",
+				Amount:         300,
+				PaymentMethod:  "tok_visa",
+			}
+
+			_, err := gateway.Capture(ctx, "pi_unknown")
+			assert.ErrorIs(t, err, payments.ErrIntentNotFound)
+
+			_, err = gateway.Authorize(ctx, &payments.AuthorizeRequest{IdempotencyKey: "order-1", Reference: "1", Amount: 300, PaymentMethod: payments.PaymentMethod_Decline})
+			assert.ErrorIs(t, err, payments.ErrDeclined)
+
+			intent, err := gateway.Authorize(ctx, req)
+			assert.Nil(t, err)
+			assert.Equal(t, payments.IntentStatus_Authorized, intent.Status)
+
+			// the same key authorizes once
+			again, err := gateway.Authorize(ctx, req)
+			assert.Nil(t, err)
+			assert.Equal(t, intent.ID, again.ID)
+			_, err = gateway.Authorize(ctx, &payments.AuthorizeRequest{IdempotencyKey: "order-1", Reference: "1", Amount: 400, PaymentMethod: "tok_visa"})
+			assert.ErrorIs(t, err, payments.ErrIdempotencyConflict)
+
+			_, err = gateway.Refund(ctx, intent.ID)
+			assert.ErrorIs(t, err, payments.ErrInvalidState)
+
+			for i := 0; i < 2; i++ {
+				captured, err := gateway.Capture(ctx, intent.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, payments.IntentStatus_Captured, captured.Status)
+			}
+			for i := 0; i < 2; i++ {
+				refunded, err := gateway.Refund(ctx, intent.ID)
+				assert.Nil(t, err)
+				assert.Equal(t, payments.IntentStatus_Refunded, refunded.Status)
+			}
+
+			_, err = gateway.Capture(ctx, intent.ID)
+			assert.ErrorIs(t, err, payments.ErrInvalidState)
+			assert.Nil(t, gateway.Check(ctx))
+		})
+	}
+}
+
+func TestFakeGatewayIsDeterministic(t *testing.T) {
+	req := &payments.AuthorizeRequest{IdempotencyKey: "order-7", Reference: "7", Amount: 100, PaymentMethod: "tok_visa"}
+
+	first, err := newFakeGateway(t).Authorize(context.Background(), req)
+	assert.Nil(t, err)
+	second, err := newFakeGateway(t).Authorize(context.Background(), req)
+	assert.Nil(t, err)
+
+	assert.Equal(t, first.ID, second.ID)
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	gateway := newFakeGateway(t)
+	event := payments.NewEvent(payments.EventType_Captured, &payments.Intent{ID: "pi_1", Reference: "1", Amount: 300})
+	payload, signature, err := gateway.SignWebhook(event)
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		payload       string
+		signature     string
+		expectedError error
+	}{
+		"valid": {
+			payload:   string(payload),
+			signature: signature,
+		},
+		"no signature": {
+			payload:       string(payload),
+			expectedError: payments.ErrInvalidSignature,
+		},
+		"tampered payload": {
+			payload:       string(payload) + " ",
+			signature:     signature,
+			expectedError: payments.ErrInvalidSignature,
+		},
+		"replaced timestamp": {
+			payload:       string(payload),
+			signature:     "t=1,v1=" + signature[len(signature)-64:],
+			expectedError: payments.ErrInvalidSignature,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			verified, err := gateway.VerifyWebhook([]byte(test.payload), test.signature)
+			assert.Equal(t, test.expectedError, err)
+			if err == nil {
+				assert.Equal(t, event.ID, verified.ID)
+				assert.Equal(t, "pi_1", verified.Intent.ID)
+			}
+		})
+	}
+
+	// a signature computed by another secret does not verify
+	viper.Set("payments.webhook_secret", "another-secret")
+	other, err := payments.NewFakeGateway()
+	assert.Nil(t, err)
+	_, err = other.VerifyWebhook(payload, signature)
+	assert.Equal(t, payments.ErrInvalidSignature, err)
+
+	viper.Set("payments.webhook_secret", "webhook-secret")
+	viper.Set("payments.webhook_tolerance", "1ns")
+	strict, err := payments.NewFakeGateway()
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond)
+	_, err = strict.VerifyWebhook(payload, signature)
+	assert.Equal(t, payments.ErrSignatureExpired, err)
+}
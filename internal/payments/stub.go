@@ -0,0 +1,158 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// errorCodes are the codes the stub server answers errors with.
+var errorCodes = map[string]error{
+	"invalid_request":      ErrInvalidRequest,
+	"declined":             ErrDeclined,
+	"not_found":            ErrIntentNotFound,
+	"idempotency_conflict": ErrIdempotencyConflict,
+	"invalid_state":        ErrInvalidState,
+}
+
+var errorStatuses = map[string]int{
+	"invalid_request":      http.StatusBadRequest,
+	"declined":             http.StatusPaymentRequired,
+	"not_found":            http.StatusNotFound,
+	"idempotency_conflict": http.StatusConflict,
+	"invalid_state":        http.StatusConflict,
+}
+
+type stubError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// StubServer serves a FakeGateway over http for the HTTPGateway. When
+// payments.stub.webhook_url is set, captures and refunds are followed by a
+// signed webhook posted there, like a real provider would.
+type StubServer struct {
+	logger     *zap.Logger
+	gateway    *FakeGateway
+	webhookURL string
+	client     *http.Client
+}
+
+func NewStubServer(logger *zap.Logger, gateway *FakeGateway) *StubServer {
+	return &StubServer{
+		logger:     logger,
+		gateway:    gateway,
+		webhookURL: viper.GetString("payments.stub.webhook_url"),
+		client:     &http.Client{Timeout: defaultHTTPTimeout},
+	}
+}
+
+func (s *StubServer) RegisterRoutes(router gin.IRouter) {
+	router.GET("/v1/ping", s.ping)
+	router.POST("/v1/intents", s.authorize)
+	router.POST("/v1/intents/:id/capture", s.capture)
+	router.POST("/v1/intents/:id/refund", s.refund)
+}
+
+func (s *StubServer) ping(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"message": "pong"})
+}
+
+func (s *StubServer) authorize(c *gin.Context) {
+	req := &AuthorizeRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		s.fail(c, ErrInvalidRequest)
+		return
+	}
+	req.IdempotencyKey = c.GetHeader(IdempotencyKeyHeader)
+
+	intent, err := s.gateway.Authorize(c.Request.Context(), req)
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, intent)
+}
+
+func (s *StubServer) capture(c *gin.Context) {
+	intent, err := s.gateway.Capture(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+
+	s.notify(EventType_Captured, intent)
+	c.JSON(http.StatusOK, intent)
+}
+
+func (s *StubServer) refund(c *gin.Context) {
+	intent, err := s.gateway.Refund(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.fail(c, err)
+		return
+	}
+
+	s.notify(EventType_Refunded, intent)
+	c.JSON(http.StatusOK, intent)
+}
+
+func (s *StubServer) fail(c *gin.Context, err error) {
+	for code, codeErr := range errorCodes {
+		if errors.Is(err, codeErr) {
+			c.JSON(errorStatuses[code], stubError{Error: err.Error(), Code: code})
+			return
+		}
+	}
+
+	s.logger.Error("Fake payment gateway failed", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, stubError{Error: err.Error()})
+}
+
+// notify posts the webhook of the event in the background, it is sent once
+// and a failure is only logged.
+func (s *StubServer) notify(eventType string, intent *Intent) {
+	if s.webhookURL == "" {
+		return
+	}
+
+	event := NewEvent(eventType, intent)
+	payload, signature, err := s.gateway.SignWebhook(event)
+	if err != nil {
+		s.logger.Error("Sign payment webhook failed", zap.Error(err), zap.String("event_id", event.ID))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultHTTPTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			s.logger.Error("Create payment webhook failed", zap.Error(err))
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, signature)
+
+		started := time.Now()
+		resp, err := s.client.Do(req)
+		if err != nil {
+			s.logger.Error("Send payment webhook failed", zap.Error(err), zap.String("event_id", event.ID))
+			return
+		}
+		resp.Body.Close()
+
+		s.logger.Info("Sent payment webhook",
+			zap.String("event_id", event.ID),
+			zap.String("type", event.Type),
+			zap.Int("status", resp.StatusCode),
+			zap.Duration("latency", time.Since(started)))
+	}()
+}
@@ -0,0 +1,106 @@
+package pricing
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrInvalidConfig = errors.New("pricing configuration is invalid")
+	ErrUnknownRegion = errors.New("region is not supported")
+)
+
+// Quote is the price of a cart shipped to Region: the promotions are applied
+// to the Subtotal of the items, then shipping and the tax on the discounted
+// items are added to the Total.
+type Quote struct {
+	Items         []*models.CartLine     `json:"items"`
+	TotalQuantity uint                   `json:"totalQuantity"`
+	Subtotal      uint                   `json:"subtotal"`
+	Discounts     []*promotions.Discount `json:"discounts"`
+	Discount      uint                   `json:"discount"`
+	Region        string                 `json:"region,omitempty"`
+	Shipping      uint                   `json:"shipping"`
+	Tax           uint                   `json:"tax"`
+	Total         uint                   `json:"total"`
+}
+
+// Pricer prices carts with the promotions, a shipping and a tax calculator.
+type Pricer struct {
+	tax           TaxCalculator
+	shipping      ShippingCalculator
+	defaultRegion string
+}
+
+// New returns the pricer configured in the pricing section.
+// pricing.default_region is the region of the carts which do not name one.
+func New() (*Pricer, error) {
+	tax, err := newTaxCalculator()
+	if err != nil {
+		return nil, err
+	}
+	shipping, err := newShippingCalculator()
+	if err != nil {
+		return nil, err
+	}
+
+	pricer := NewPricer(tax, shipping)
+	pricer.defaultRegion = NormalizeRegion(viper.GetString("pricing.default_region"))
+	return pricer, nil
+}
+
+func NewPricer(tax TaxCalculator, shipping ShippingCalculator) *Pricer {
+	return &Pricer{
+		tax:      tax,
+		shipping: shipping,
+	}
+}
+
+// NormalizeRegion makes regions case insensitive.
+func NormalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+// Price quotes the lines of a cart shipped to region at now, see
+// promotions.Price for how the promotions and the coupon of code apply. An
+// empty cart is not charged shipping nor tax.
+func (p *Pricer) Price(lines []*models.CartLine, candidates []*models.Promotion, code, region string, now time.Time) (*Quote, error) {
+	breakdown, err := promotions.Price(lines, candidates, code, now)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &Quote{
+		Items:     breakdown.Items,
+		Subtotal:  breakdown.Subtotal,
+		Discounts: breakdown.Discounts,
+		Discount:  breakdown.Discount,
+		Region:    NormalizeRegion(region),
+	}
+	if quote.Region == "" {
+		quote.Region = p.defaultRegion
+	}
+
+	if len(quote.Items) > 0 {
+		shipment := &Shipment{Region: quote.Region, Subtotal: breakdown.Total}
+		for _, line := range quote.Items {
+			shipment.Weight += line.Weight * line.Quantity
+			shipment.Quantity += line.Quantity
+		}
+		quote.TotalQuantity = shipment.Quantity
+		if quote.Shipping, err = p.shipping.Rate(shipment); err != nil {
+			return nil, err
+		}
+		if quote.Tax, err = p.tax.Tax(quote.Region, breakdown.Total); err != nil {
+			return nil, err
+		}
+	}
+	quote.Total = breakdown.Total + quote.Shipping + quote.Tax
+
+	return quote, nil
+}
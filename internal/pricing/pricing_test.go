@@ -0,0 +1,204 @@
+package pricing_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateTable(t *testing.T) {
+	rates, err := pricing.NewRateTable(map[string]uint{"us": 0, "US-CA": 725, "vn": 1000})
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		region        string
+		amount        uint
+		expectedTax   uint
+		expectedError error
+	}{
+		"country": {
+			region:      "VN",
+			amount:      285,
+			expectedTax: 29,
+		},
+		"subdivision": {
+			region:      "US-CA",
+			amount:      400,
+			expectedTax: 29,
+		},
+		"subdivision falls back to its country": {
+			region: "US-OR",
+			amount: 400,
+		},
+		"unknown region": {
+			region:        "FR",
+			amount:        400,
+			expectedError: pricing.ErrUnknownRegion,
+		},
+		"no region": {
+			amount:        400,
+			expectedError: pricing.ErrUnknownRegion,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tax, err := rates.Tax(test.region, test.amount)
+			assert.Equal(t, test.expectedError, err)
+			assert.Equal(t, test.expectedTax, tax)
+		})
+	}
+
+	_, err = pricing.NewRateTable(map[string]uint{"VN": 10001})
+	assert.ErrorIs(t, err, pricing.ErrInvalidConfig)
+}
+
+func TestShippingCalculators(t *testing.T) {
+	tests := map[string]struct {
+		calculator   pricing.ShippingCalculator
+		shipment     *pricing.Shipment
+		expectedRate uint
+	}{
+		"flat": {
+			calculator:   &pricing.FlatRate{Amount: 10},
+			shipment:     &pricing.Shipment{Subtotal: 100, Weight: 5000, Quantity: 3},
+			expectedRate: 10,
+		},
+		"weight rounds up to the kilogram": {
+			calculator:   &pricing.WeightRate{Base: 5, PerKg: 2},
+			shipment:     &pricing.Shipment{Subtotal: 100, Weight: 2001, Quantity: 1},
+			expectedRate: 11,
+		},
+		"weightless products pay the base": {
+			calculator:   &pricing.WeightRate{Base: 5, PerKg: 2},
+			shipment:     &pricing.Shipment{Subtotal: 100, Quantity: 1},
+			expectedRate: 5,
+		},
+		"under the free threshold": {
+			calculator:   &pricing.FreeOver{Threshold: 300, Calculator: &pricing.FlatRate{Amount: 10}},
+			shipment:     &pricing.Shipment{Subtotal: 299, Quantity: 1},
+			expectedRate: 10,
+		},
+		"at the free threshold": {
+			calculator: &pricing.FreeOver{Threshold: 300, Calculator: &pricing.FlatRate{Amount: 10}},
+			shipment:   &pricing.Shipment{Subtotal: 300, Quantity: 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rate, err := test.calculator.Rate(test.shipment)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedRate, rate)
+		})
+	}
+}
+
+func TestPrice(t *testing.T) {
+	rates, err := pricing.NewRateTable(map[string]uint{"VN": 1000})
+	assert.Nil(t, err)
+	pricer := pricing.NewPricer(rates, &pricing.FreeOver{Threshold: 500, Calculator: &pricing.WeightRate{Base: 5, PerKg: 2}})
+	now := time.Now()
+
+	lines := func() []*models.CartLine {
+		return []*models.CartLine{
+			{ProductID: 1, Name: "Boots", Price: 200, Weight: 1500, Quantity: 2},
+			{ProductID: 2, Name: "Socks", Price: 5, Weight: 100, Quantity: 4},
+		}
+	}
+	sale := []*models.Promotion{{ID: 1, Name: "Sale", Type: models.PromotionType_FixedAmount, Value: 20}}
+
+	// the tax applies to the discounted items, shipping is not taxed
+	quote, err := pricer.Price(lines(), sale, "", "vn", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "VN", quote.Region)
+	assert.EqualValues(t, 420, quote.Subtotal)
+	assert.EqualValues(t, 20, quote.Discount)
+	assert.EqualValues(t, 13, quote.Shipping)
+	assert.EqualValues(t, 40, quote.Tax)
+	assert.EqualValues(t, 453, quote.Total)
+
+	// free shipping is checked against the subtotal once discounted
+	more := append(lines(), &models.CartLine{ProductID: 3, Name: "Laces", Price: 100, Quantity: 1})
+	quote, err = pricer.Price(more, sale, "", "VN", now)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, quote.Shipping)
+	assert.EqualValues(t, 50, quote.Tax)
+	assert.EqualValues(t, 550, quote.Total)
+
+	quote, err = pricer.Price(nil, sale, "", "", now)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, quote.Shipping)
+	assert.EqualValues(t, 0, quote.Tax)
+	assert.EqualValues(t, 0, quote.Total)
+
+	_, err = pricer.Price(lines(), sale, "", "FR", now)
+	assert.Equal(t, pricing.ErrUnknownRegion, err)
+	_, err = pricer.Price(lines(), sale, "NOPE", "VN", now)
+	assert.Equal(t, promotions.ErrCouponNotFound, err)
+}
+
+func TestNew(t *testing.T) {
+	tests := map[string]struct {
+		config        map[string]interface{}
+		expectedError error
+		expectedTotal uint
+	}{
+		"no charges by default": {
+			expectedTotal: 400,
+		},
+		"rates and flat shipping to the default region": {
+			config: map[string]interface{}{
+				"pricing.default_region":  "vn",
+				"pricing.tax.driver":      pricing.TaxDriverRates,
+				"pricing.tax.rates":       map[string]interface{}{"vn": 1000},
+				"pricing.shipping.driver": pricing.ShippingDriverFlat,
+				"pricing.shipping.flat":   map[string]interface{}{"rate": 10},
+			},
+			expectedTotal: 450,
+		},
+		"weight shipping free over a threshold": {
+			config: map[string]interface{}{
+				"pricing.shipping.driver":    pricing.ShippingDriverWeight,
+				"pricing.shipping.weight":    map[string]interface{}{"base": 5, "per_kg": 2},
+				"pricing.shipping.free_over": 400,
+			},
+			expectedTotal: 400,
+		},
+		"unknown tax driver": {
+			config:        map[string]interface{}{"pricing.tax.driver": "vat"},
+			expectedError: pricing.ErrInvalidConfig,
+		},
+		"unknown shipping driver": {
+			config:        map[string]interface{}{"pricing.shipping.driver": "drone"},
+			expectedError: pricing.ErrInvalidConfig,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			for key, value := range test.config {
+				viper.Set(key, value)
+			}
+
+			pricer, err := pricing.New()
+			if test.expectedError != nil {
+				assert.True(t, errors.Is(err, test.expectedError), err)
+				return
+			}
+			assert.Nil(t, err)
+
+			quote, err := pricer.Price([]*models.CartLine{{ProductID: 1, Price: 200, Weight: 1500, Quantity: 2}}, nil, "", "", time.Now())
+			assert.Nil(t, err)
+			assert.Equal(t, test.expectedTotal, quote.Total)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package pricing
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ShippingDriverFlat   = "flat"
+	ShippingDriverWeight = "weight"
+)
+
+// Shipment is what is shipped to a region. Subtotal is the price of the
+// products once discounted and Weight their weight in grams.
+type Shipment struct {
+	Region   string
+	Subtotal uint
+	Weight   uint
+	Quantity uint
+}
+
+// ShippingCalculator computes the shipping rate of a shipment.
+type ShippingCalculator interface {
+	Rate(shipment *Shipment) (uint, error)
+}
+
+// FlatRate charges Amount for every shipment.
+type FlatRate struct {
+	Amount uint
+}
+
+func (r *FlatRate) Rate(shipment *Shipment) (uint, error) {
+	return r.Amount, nil
+}
+
+// WeightRate charges Base plus PerKg for every started kilogram.
+type WeightRate struct {
+	Base  uint
+	PerKg uint
+}
+
+func (r *WeightRate) Rate(shipment *Shipment) (uint, error) {
+	kgs := (shipment.Weight + 999) / 1000
+	return r.Base + kgs*r.PerKg, nil
+}
+
+// FreeOver ships free the shipments whose subtotal reaches Threshold, the
+// others are charged the rate of Calculator.
+type FreeOver struct {
+	Threshold  uint
+	Calculator ShippingCalculator
+}
+
+func (r *FreeOver) Rate(shipment *Shipment) (uint, error) {
+	if shipment.Subtotal >= r.Threshold {
+		return 0, nil
+	}
+	return r.Calculator.Rate(shipment)
+}
+
+// newShippingCalculator returns the shipping calculator of
+// pricing.shipping.driver, free over pricing.shipping.free_over when it is
+// set.
+func newShippingCalculator() (ShippingCalculator, error) {
+	var calculator ShippingCalculator
+	switch driver := viper.GetString("pricing.shipping.driver"); driver {
+	case "", ShippingDriverFlat:
+		calculator = &FlatRate{Amount: viper.GetUint("pricing.shipping.flat.rate")}
+	case ShippingDriverWeight:
+		calculator = &WeightRate{
+			Base:  viper.GetUint("pricing.shipping.weight.base"),
+			PerKg: viper.GetUint("pricing.shipping.weight.per_kg"),
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown shipping driver %q", ErrInvalidConfig, driver)
+	}
+
+	if threshold := viper.GetUint("pricing.shipping.free_over"); threshold > 0 {
+		calculator = &FreeOver{Threshold: threshold, Calculator: calculator}
+	}
+	return calculator, nil
+}
@@ -0,0 +1,76 @@
+package pricing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+var (
+	TaxDriverNone  = "none"
+	TaxDriverRates = "rates"
+)
+
+// TaxCalculator computes the tax due on amount for a region.
+type TaxCalculator interface {
+	Tax(region string, amount uint) (uint, error)
+}
+
+// NoTax charges no tax, whatever the region.
+type NoTax struct{}
+
+func (NoTax) Tax(region string, amount uint) (uint, error) {
+	return 0, nil
+}
+
+// RateTable charges the rate of the region, in basis points. A subdivision
+// like US-CA without a rate of its own falls back to the rate of its country,
+// regions without any rate are ErrUnknownRegion.
+type RateTable struct {
+	rates map[string]uint
+}
+
+// NewRateTable returns a rate table of rates, keyed by region.
+func NewRateTable(rates map[string]uint) (*RateTable, error) {
+	table := &RateTable{rates: make(map[string]uint, len(rates))}
+	for region, rate := range rates {
+		if rate > 10000 {
+			return nil, fmt.Errorf("%w: tax rate of %s is above 100%%", ErrInvalidConfig, region)
+		}
+		table.rates[NormalizeRegion(region)] = rate
+	}
+	return table, nil
+}
+
+func (t *RateTable) Tax(region string, amount uint) (uint, error) {
+	rate, ok := t.rates[region]
+	if !ok {
+		if i := strings.IndexByte(region, '-'); i > 0 {
+			rate, ok = t.rates[region[:i]]
+		}
+	}
+	if !ok {
+		return 0, ErrUnknownRegion
+	}
+
+	// rounded half up to the unit of the prices
+	return (amount*rate + 5000) / 10000, nil
+}
+
+// newTaxCalculator returns the tax calculator of pricing.tax.driver.
+func newTaxCalculator() (TaxCalculator, error) {
+	switch driver := viper.GetString("pricing.tax.driver"); driver {
+	case "", TaxDriverNone:
+		return NoTax{}, nil
+	case TaxDriverRates:
+		rates := make(map[string]uint)
+		for region, rate := range viper.GetStringMap("pricing.tax.rates") {
+			rates[region] = cast.ToUint(rate)
+		}
+		return NewRateTable(rates)
+	default:
+		return nil, fmt.Errorf("%w: unknown tax driver %q", ErrInvalidConfig, driver)
+	}
+}
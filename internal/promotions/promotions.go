@@ -0,0 +1,205 @@
+package promotions
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+)
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to the cart")
+)
+
+// IsCouponError reports whether err tells why a coupon cannot be used.
+func IsCouponError(err error) bool {
+	for _, couponErr := range []error{
+		ErrCouponNotFound,
+		ErrCouponNotApplicable,
+		models.ErrPromotionNotStarted,
+		models.ErrPromotionExpired,
+		models.ErrPromotionUsedUp,
+	} {
+		if errors.Is(err, couponErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOrder is the order promotions are applied in: free products first, then
+// percentages, then fixed amounts, so a percentage never applies to products
+// already given away and fixed amounts are not reduced by percentages.
+var typeOrder = map[string]int{
+	models.PromotionType_BuyXGetY:    0,
+	models.PromotionType_Percentage:  1,
+	models.PromotionType_FixedAmount: 2,
+}
+
+// Discount is what a promotion takes off the cart.
+type Discount struct {
+	PromotionID uint   `json:"promotionId"`
+	Name        string `json:"name"`
+	Code        string `json:"code,omitempty"`
+	Amount      uint   `json:"amount"`
+}
+
+// Breakdown is the price of a cart once the promotions are applied.
+type Breakdown struct {
+	Items     []*models.CartLine `json:"items"`
+	Subtotal  uint               `json:"subtotal"`
+	Discounts []*Discount        `json:"discounts"`
+	Discount  uint               `json:"discount"`
+	Total     uint               `json:"total"`
+}
+
+// Price applies the promotions to the lines of a cart at now. Every promotion
+// without a code which can be used and matches the cart applies, plus the
+// coupon of code when it is not empty. A coupon which cannot be used or does
+// not match the cart is an error, promotions without a code are skipped.
+//
+// Promotions stack: each one applies to what the previous ones left of the
+// price of its products, so the total never goes below zero.
+func Price(lines []*models.CartLine, promotions []*models.Promotion, code string, now time.Time) (*Breakdown, error) {
+	cart := models.NewCart(lines)
+	breakdown := &Breakdown{
+		Items:     cart.Items,
+		Subtotal:  cart.Total,
+		Discounts: []*Discount{},
+	}
+
+	code = models.NormalizeCouponCode(code)
+	var (
+		applicable []*models.Promotion
+		coupon     *models.Promotion
+	)
+	for _, promotion := range promotions {
+		if !promotion.IsCoupon() {
+			if promotion.Check(now) == nil {
+				applicable = append(applicable, promotion)
+			}
+			continue
+		}
+		if code != "" && *promotion.Code == code {
+			coupon = promotion
+		}
+	}
+	if code != "" {
+		if coupon == nil {
+			return nil, ErrCouponNotFound
+		}
+		if err := coupon.Check(now); err != nil {
+			return nil, err
+		}
+		applicable = append(applicable, coupon)
+	}
+
+	sort.SliceStable(applicable, func(i, j int) bool {
+		if typeOrder[applicable[i].Type] != typeOrder[applicable[j].Type] {
+			return typeOrder[applicable[i].Type] < typeOrder[applicable[j].Type]
+		}
+		return applicable[i].ID < applicable[j].ID
+	})
+
+	// remaining is what is left to pay of every line
+	remaining := make([]uint, len(cart.Items))
+	for i, line := range cart.Items {
+		remaining[i] = line.Subtotal
+	}
+
+	for _, promotion := range applicable {
+		amount := apply(promotion, cart.Items, remaining)
+		if amount == 0 {
+			if promotion == coupon {
+				return nil, ErrCouponNotApplicable
+			}
+			continue
+		}
+
+		discount := &Discount{
+			PromotionID: promotion.ID,
+			Name:        promotion.Name,
+			Amount:      amount,
+		}
+		if promotion.IsCoupon() {
+			discount.Code = *promotion.Code
+		}
+		breakdown.Discounts = append(breakdown.Discounts, discount)
+		breakdown.Discount += amount
+	}
+	breakdown.Total = breakdown.Subtotal - breakdown.Discount
+
+	return breakdown, nil
+}
+
+// apply takes the discount of the promotion off remaining and returns it, 0
+// when the promotion does not match the cart.
+func apply(promotion *models.Promotion, lines []*models.CartLine, remaining []uint) uint {
+	var (
+		eligible          []int
+		subtotal, payable uint
+	)
+	for i, line := range lines {
+		if promotion.Category == "" || line.Category == promotion.Category {
+			eligible = append(eligible, i)
+			subtotal += line.Subtotal
+			payable += remaining[i]
+		}
+	}
+	if len(eligible) == 0 || subtotal < promotion.MinSubtotal {
+		return 0
+	}
+
+	switch promotion.Type {
+	case models.PromotionType_Percentage:
+		return take(payable*promotion.Value/100, eligible, remaining)
+	case models.PromotionType_FixedAmount:
+		return take(min(promotion.Value, payable), eligible, remaining)
+	case models.PromotionType_BuyXGetY:
+		return giveAway(promotion, lines, eligible, remaining)
+	}
+	return 0
+}
+
+// take takes amount off the eligible lines, in the order of the cart.
+func take(amount uint, eligible []int, remaining []uint) uint {
+	left := amount
+	for _, i := range eligible {
+		taken := min(remaining[i], left)
+		remaining[i] -= taken
+		left -= taken
+	}
+	return amount - left
+}
+
+// giveAway makes GetQuantity of every BuyQuantity + GetQuantity eligible
+// products free, the cheapest ones.
+func giveAway(promotion *models.Promotion, lines []*models.CartLine, eligible []int, remaining []uint) uint {
+	var units []int
+	for _, i := range eligible {
+		for n := uint(0); n < lines[i].Quantity; n++ {
+			units = append(units, i)
+		}
+	}
+	sort.SliceStable(units, func(a, b int) bool {
+		return lines[units[a]].Price < lines[units[b]].Price
+	})
+
+	free := uint(len(units)) / (promotion.BuyQuantity + promotion.GetQuantity) * promotion.GetQuantity
+	var amount uint
+	for _, i := range units[:free] {
+		taken := min(lines[i].Price, remaining[i])
+		remaining[i] -= taken
+		amount += taken
+	}
+	return amount
+}
+
+func min(a, b uint) uint {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,343 @@
+package promotions_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2022, 11, 15, 12, 0, 0, 0, time.UTC)
+
+func code(c string) *string {
+	return &c
+}
+
+// cart returns shoes at 100, a shirt at 40 and socks at 5.
+func cart(shoes, shirts, socks uint) []*models.CartLine {
+	lines := []*models.CartLine{}
+	if shoes > 0 {
+		lines = append(lines, &models.CartLine{ProductID: 1, Name: "Shoes", Category: "shoes", Price: 100, Quantity: shoes})
+	}
+	if shirts > 0 {
+		lines = append(lines, &models.CartLine{ProductID: 2, Name: "Shirt", Category: "clothes", Price: 40, Quantity: shirts})
+	}
+	if socks > 0 {
+		lines = append(lines, &models.CartLine{ProductID: 3, Name: "Socks", Category: "clothes", Price: 5, Quantity: socks})
+	}
+	return lines
+}
+
+func TestPrice(t *testing.T) {
+	tests := map[string]struct {
+		lines             []*models.CartLine
+		promotions        []*models.Promotion
+		code              string
+		expectedDiscounts []uint
+		expectedTotal     uint
+		expectedError     error
+	}{
+		"no promotion": {
+			lines:             cart(1, 1, 0),
+			expectedDiscounts: []uint{},
+			expectedTotal:     140,
+		},
+		"percentage": {
+			lines: cart(1, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10% off", Type: models.PromotionType_Percentage, Value: 10},
+			},
+			expectedDiscounts: []uint{14},
+			expectedTotal:     126,
+		},
+		"percentage rounds down": {
+			lines: cart(0, 0, 3),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10% off", Type: models.PromotionType_Percentage, Value: 10},
+			},
+			expectedDiscounts: []uint{1},
+			expectedTotal:     14,
+		},
+		"fixed amount": {
+			lines: cart(1, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "20 off", Type: models.PromotionType_FixedAmount, Value: 20},
+			},
+			expectedDiscounts: []uint{20},
+			expectedTotal:     120,
+		},
+		"fixed amount is capped by the cart": {
+			lines: cart(0, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "50 off", Type: models.PromotionType_FixedAmount, Value: 50},
+			},
+			expectedDiscounts: []uint{40},
+			expectedTotal:     0,
+		},
+		"buy 2 get 1 gives the cheapest away": {
+			lines: cart(1, 1, 1),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "3 for 2", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			},
+			expectedDiscounts: []uint{5},
+			expectedTotal:     140,
+		},
+		"buy 2 get 1 counts every set": {
+			lines: cart(0, 3, 4),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "3 for 2", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			},
+			// 7 products make 2 sets, the 2 cheapest are free
+			expectedDiscounts: []uint{10},
+			expectedTotal:     130,
+		},
+		"buy 2 get 1 needs a full set": {
+			lines: cart(1, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "3 for 2", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     140,
+		},
+		"category scoped percentage": {
+			lines: cart(1, 1, 2),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Clothes 50% off", Type: models.PromotionType_Percentage, Value: 50, Category: "clothes"},
+			},
+			expectedDiscounts: []uint{25},
+			expectedTotal:     125,
+		},
+		"category scoped buy x get y only counts the category": {
+			lines: cart(2, 0, 1),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Clothes 3 for 2", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1, Category: "clothes"},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     205,
+		},
+		"category without products in the cart": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Clothes 20 off", Type: models.PromotionType_FixedAmount, Value: 20, Category: "clothes"},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     100,
+		},
+		"minimum subtotal reached": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10 off 100", Type: models.PromotionType_FixedAmount, Value: 10, MinSubtotal: 100},
+			},
+			expectedDiscounts: []uint{10},
+			expectedTotal:     90,
+		},
+		"minimum subtotal of the category not reached": {
+			lines: cart(1, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10 off 100 of clothes", Type: models.PromotionType_FixedAmount, Value: 10, MinSubtotal: 100, Category: "clothes"},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     140,
+		},
+		"percentage applies after buy x get y": {
+			lines: cart(0, 2, 1),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "50% off", Type: models.PromotionType_Percentage, Value: 50},
+				{ID: 2, Name: "3 for 2", Type: models.PromotionType_BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			},
+			// socks are free, half of the shirts is off
+			expectedDiscounts: []uint{5, 40},
+			expectedTotal:     40,
+		},
+		"fixed amount applies after percentage": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10 off", Type: models.PromotionType_FixedAmount, Value: 10},
+				{ID: 2, Name: "10% off", Type: models.PromotionType_Percentage, Value: 10},
+			},
+			expectedDiscounts: []uint{10, 10},
+			expectedTotal:     80,
+		},
+		"stacked promotions never go below zero": {
+			lines: cart(0, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "30 off", Type: models.PromotionType_FixedAmount, Value: 30},
+				{ID: 2, Name: "30 more off", Type: models.PromotionType_FixedAmount, Value: 30},
+				{ID: 3, Name: "Nothing left", Type: models.PromotionType_FixedAmount, Value: 30},
+			},
+			expectedDiscounts: []uint{30, 10},
+			expectedTotal:     0,
+		},
+		"stacked category promotions only take from their category": {
+			lines: cart(1, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Shoes 50% off", Type: models.PromotionType_Percentage, Value: 50, Category: "shoes"},
+				{ID: 2, Name: "Clothes 50 off", Type: models.PromotionType_FixedAmount, Value: 50, Category: "clothes"},
+				{ID: 3, Name: "Everything 10% off", Type: models.PromotionType_Percentage, Value: 10},
+			},
+			// 10% of the 90 left of the shoes and the shirt, then the shirt
+			expectedDiscounts: []uint{50, 9, 40},
+			expectedTotal:     41,
+		},
+		"automatic promotion not started yet is skipped": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Next week", Type: models.PromotionType_FixedAmount, Value: 10, StartsAt: now.Add(24 * time.Hour).UnixMilli()},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     100,
+		},
+		"expired automatic promotion is skipped": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Last week", Type: models.PromotionType_FixedAmount, Value: 10, EndsAt: now.Add(-24 * time.Hour).UnixMilli()},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     100,
+		},
+		"used up automatic promotion is skipped": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "First 10 orders", Type: models.PromotionType_FixedAmount, Value: 10, UsageLimit: 10, UsageCount: 10},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     100,
+		},
+		"running automatic promotion": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "This week", Type: models.PromotionType_FixedAmount, Value: 10, StartsAt: now.Add(-24 * time.Hour).UnixMilli(), EndsAt: now.Add(24 * time.Hour).UnixMilli(), UsageLimit: 10, UsageCount: 9},
+			},
+			expectedDiscounts: []uint{10},
+			expectedTotal:     90,
+		},
+		"coupon is not applied without its code": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     100,
+		},
+		"coupon code is case insensitive": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10},
+			},
+			code:              " save10 ",
+			expectedDiscounts: []uint{10},
+			expectedTotal:     90,
+		},
+		"coupon stacks with automatic promotions": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10% off", Type: models.PromotionType_Percentage, Value: 10},
+				{ID: 2, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10},
+				{ID: 3, Name: "Other coupon", Code: code("SAVE20"), Type: models.PromotionType_FixedAmount, Value: 20},
+			},
+			code:              "SAVE10",
+			expectedDiscounts: []uint{10, 10},
+			expectedTotal:     80,
+		},
+		"unknown coupon": {
+			lines:         cart(1, 0, 0),
+			code:          "NOPE",
+			expectedError: promotions.ErrCouponNotFound,
+		},
+		"coupon not started yet": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10, StartsAt: now.Add(time.Hour).UnixMilli()},
+			},
+			code:          "SAVE10",
+			expectedError: models.ErrPromotionNotStarted,
+		},
+		"expired coupon": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10, EndsAt: now.UnixMilli()},
+			},
+			code:          "SAVE10",
+			expectedError: models.ErrPromotionExpired,
+		},
+		"used up coupon": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10, UsageLimit: 1, UsageCount: 1},
+			},
+			code:          "SAVE10",
+			expectedError: models.ErrPromotionUsedUp,
+		},
+		"coupon of another category": {
+			lines: cart(1, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Clothes coupon", Code: code("CLOTHES"), Type: models.PromotionType_Percentage, Value: 10, Category: "clothes"},
+			},
+			code:          "CLOTHES",
+			expectedError: promotions.ErrCouponNotApplicable,
+		},
+		"coupon below its minimum subtotal": {
+			lines: cart(0, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10, MinSubtotal: 50},
+			},
+			code:          "SAVE10",
+			expectedError: promotions.ErrCouponNotApplicable,
+		},
+		"coupon with nothing left to discount": {
+			lines: cart(0, 1, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "Everything free", Type: models.PromotionType_Percentage, Value: 100},
+				{ID: 2, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10},
+			},
+			code:          "SAVE10",
+			expectedError: promotions.ErrCouponNotApplicable,
+		},
+		"empty cart": {
+			lines: cart(0, 0, 0),
+			promotions: []*models.Promotion{
+				{ID: 1, Name: "10 off", Type: models.PromotionType_FixedAmount, Value: 10},
+			},
+			expectedDiscounts: []uint{},
+			expectedTotal:     0,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			breakdown, err := promotions.Price(test.lines, test.promotions, test.code, now)
+			assert.Equal(t, test.expectedError, err)
+			if err != nil {
+				return
+			}
+
+			discounts := []uint{}
+			var total uint
+			for _, discount := range breakdown.Discounts {
+				discounts = append(discounts, discount.Amount)
+				total += discount.Amount
+			}
+			assert.Equal(t, test.expectedDiscounts, discounts)
+			assert.Equal(t, total, breakdown.Discount)
+			assert.Equal(t, test.expectedTotal, breakdown.Total)
+			assert.Equal(t, breakdown.Subtotal-breakdown.Discount, breakdown.Total)
+		})
+	}
+}
+
+func TestPriceNamesTheCoupon(t *testing.T) {
+	breakdown, err := promotions.Price(cart(1, 0, 0), []*models.Promotion{
+		{ID: 7, Name: "Coupon", Code: code("SAVE10"), Type: models.PromotionType_FixedAmount, Value: 10},
+	}, "save10", now)
+	assert.Nil(t, err)
+	assert.Equal(t, []*promotions.Discount{{PromotionID: 7, Name: "Coupon", Code: "SAVE10", Amount: 10}}, breakdown.Discounts)
+}
+
+func TestIsCouponError(t *testing.T) {
+	assert.True(t, promotions.IsCouponError(promotions.ErrCouponNotFound))
+	assert.True(t, promotions.IsCouponError(models.ErrPromotionUsedUp))
+	assert.False(t, promotions.IsCouponError(models.ErrEmptyCart))
+	assert.False(t, promotions.IsCouponError(nil))
+}
@@ -0,0 +1,213 @@
+package relays
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/metrics"
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	defaultPollInterval = 1 * time.Second
+	defaultBatchSize    = uint(100)
+	defaultMaxAttempts  = uint(10)
+	maxRetryBackoff     = 5 * time.Minute
+)
+
+type producer interface {
+	Publish(ctx context.Context, topic, key string, value []byte, done func(error)) error
+}
+
+type repository interface {
+	GetPendingOutboxMessages(ctx context.Context, limit uint) ([]*models.OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id uint64) error
+	MarkOutboxMessageFailed(ctx context.Context, id uint64, reason string, nextAttemptAt int64, maxAttempts uint) error
+}
+
+// OutboxRelay periodically publishes pending outbox messages to the event bus
+// and marks them as sent, so events written by the handlers survive broker
+// outages and process restarts.
+type OutboxRelay struct {
+	logger       *zap.Logger
+	repo         repository
+	producer     producer
+	pollInterval time.Duration
+	batchSize    uint
+	maxAttempts  uint
+	ctx          context.Context
+	cancelFn     context.CancelFunc
+	done         chan struct{}
+}
+
+func NewOutboxRelay(logger *zap.Logger, repo repository, producer producer) (*OutboxRelay, error) {
+	pollInterval := viper.GetDuration("outbox.poll_interval")
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	batchSize := viper.GetUint("outbox.batch_size")
+	if batchSize == 0 {
+		batchSize = defaultBatchSize
+	}
+	maxAttempts := viper.GetUint("outbox.max_attempts")
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &OutboxRelay{
+		logger:       logger,
+		repo:         repo,
+		producer:     producer,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		maxAttempts:  maxAttempts,
+		ctx:          ctx,
+		cancelFn:     cancel,
+		done:         make(chan struct{}),
+	}, nil
+}
+
+func (r *OutboxRelay) Start() error {
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.relayPending()
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// relayPending publishes one batch of pending messages and waits for all of
+// them to be acknowledged before returning, so the next poll never picks up a
+// message which is still in flight. Order is only kept per key: the keys are
+// relayed concurrently, the messages of a key one after the other in insertion
+// order. Messages of other keys pass a failed message while it backs off,
+// later messages of its key are held back until it is retried.
+func (r *OutboxRelay) relayPending() {
+	messages, err := r.repo.GetPendingOutboxMessages(r.ctx, r.batchSize)
+	if err != nil {
+		r.logger.Error("Get pending outbox messages failed", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, keyed := range groupByKey(messages) {
+		keyed := keyed
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.relayKey(keyed)
+		}()
+	}
+	wg.Wait()
+}
+
+// relayKey publishes the messages of a key, each once the previous one is
+// acknowledged. The key is not relayed any further in this batch once a
+// message fails, the remaining messages stay pending.
+func (r *OutboxRelay) relayKey(messages []*models.OutboxMessage) {
+	for _, message := range messages {
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		// the message continues the trace of the request which wrote it. The
+		// relay context is not used, the result of a message published before
+		// Stop must still be recorded.
+		ctx := tracing.Extract(context.Background(), message.Headers)
+		result := make(chan error, 1)
+		if err := r.producer.Publish(ctx, message.Topic, message.Key, []byte(message.Payload), func(err error) {
+			result <- err
+		}); err != nil {
+			r.logger.Warn("Enqueue outbox message failed", zap.Error(err), zap.Uint64("id", message.ID))
+			return
+		}
+
+		err := <-result
+		r.complete(ctx, message, err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// groupByKey splits messages by key, keeping the order of the messages of
+// every key.
+func groupByKey(messages []*models.OutboxMessage) [][]*models.OutboxMessage {
+	index := make(map[string]int)
+	var groups [][]*models.OutboxMessage
+	for _, message := range messages {
+		i, ok := index[message.Key]
+		if !ok {
+			i = len(groups)
+			index[message.Key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], message)
+	}
+	return groups
+}
+
+func (r *OutboxRelay) complete(ctx context.Context, message *models.OutboxMessage, err error) {
+	if err != nil {
+		metrics.ProducerMessages.WithLabelValues(message.Topic, metrics.Result_Failure).Inc()
+		requestid.Logger(ctx, r.logger).Error("Relay outbox message failed",
+			zap.Error(err),
+			zap.Uint64("id", message.ID),
+			zap.String("topic", message.Topic),
+			zap.Uint("attempts", message.Attempts+1))
+
+		nextAttemptAt := time.Now().Add(retryBackoff(r.pollInterval, message.Attempts)).UnixMilli()
+		if err := r.repo.MarkOutboxMessageFailed(ctx, message.ID, err.Error(), nextAttemptAt, r.maxAttempts); err != nil {
+			r.logger.Error("Mark outbox message as failed failed", zap.Error(err), zap.Uint64("id", message.ID))
+		}
+		return
+	}
+
+	metrics.ProducerMessages.WithLabelValues(message.Topic, metrics.Result_Success).Inc()
+	if err := r.repo.MarkOutboxMessageSent(ctx, message.ID); err != nil {
+		// the message will be published again on the next poll, consumers
+		// must therefore tolerate duplicates
+		r.logger.Error("Mark outbox message as sent failed", zap.Error(err), zap.Uint64("id", message.ID))
+		return
+	}
+
+	r.logger.Debug("Relayed outbox message", zap.Uint64("id", message.ID), zap.String("topic", message.Topic))
+}
+
+// Stop waits for the batch being relayed to complete. The producer is owned by
+// the caller and is not closed here.
+func (r *OutboxRelay) Stop() {
+	r.cancelFn()
+	<-r.done
+}
+
+// retryBackoff doubles the delay for every previous attempt, capped at
+// maxRetryBackoff.
+func retryBackoff(base time.Duration, attempts uint) time.Duration {
+	backoff := base
+	for i := uint(0); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,89 @@
+package relays
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// stubRepo serves a fixed batch and records what the relay marks.
+type stubRepo struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+	sent     []uint64
+	failed   []uint64
+}
+
+func (r *stubRepo) GetPendingOutboxMessages(ctx context.Context, limit uint) ([]*models.OutboxMessage, error) {
+	return r.messages, nil
+}
+
+func (r *stubRepo) MarkOutboxMessageSent(ctx context.Context, id uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, id)
+	return nil
+}
+
+func (r *stubRepo) MarkOutboxMessageFailed(ctx context.Context, id uint64, reason string, nextAttemptAt int64, maxAttempts uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, id)
+	return nil
+}
+
+// stubProducer acknowledges messages asynchronously and fails the payloads
+// of fail.
+type stubProducer struct {
+	mu        sync.Mutex
+	fail      map[string]bool
+	published map[string][]string
+}
+
+func (p *stubProducer) Publish(ctx context.Context, topic, key string, value []byte, done func(error)) error {
+	p.mu.Lock()
+	p.published[key] = append(p.published[key], string(value))
+	p.mu.Unlock()
+
+	go func() {
+		// acknowledge out of order
+		time.Sleep(time.Duration(len(value)) * time.Millisecond)
+		if p.fail[string(value)] {
+			done(errors.New("broker unavailable"))
+			return
+		}
+		done(nil)
+	}()
+	return nil
+}
+
+func TestRelayPendingKeepsPerKeyOrder(t *testing.T) {
+	repo := &stubRepo{
+		messages: []*models.OutboxMessage{
+			{ID: 1, Topic: "product-activities", Key: "1", Payload: "1-first..."},
+			{ID: 2, Topic: "product-activities", Key: "2", Payload: "2-first"},
+			{ID: 3, Topic: "product-activities", Key: "1", Payload: "1-second"},
+			{ID: 4, Topic: "product-activities", Key: "2", Payload: "2-failed"},
+			{ID: 5, Topic: "product-activities", Key: "2", Payload: "2-held-back"},
+		},
+	}
+	producer := &stubProducer{
+		fail:      map[string]bool{"2-failed": true},
+		published: make(map[string][]string),
+	}
+	relay, err := NewOutboxRelay(zap.NewNop(), repo, producer)
+	assert.Nil(t, err)
+
+	relay.relayPending()
+
+	assert.Equal(t, []string{"1-first...", "1-second"}, producer.published["1"])
+	assert.Equal(t, []string{"2-first", "2-failed"}, producer.published["2"])
+	assert.ElementsMatch(t, []uint64{1, 2, 3}, repo.sent)
+	assert.Equal(t, []uint64{4}, repo.failed)
+}
@@ -1,61 +1,171 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/ldmtam/ecommerce-demo/internal/metrics"
 	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
+	"github.com/ldmtam/ecommerce-demo/internal/promotions"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
+	"github.com/ldmtam/ecommerce-demo/internal/tracing"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	ErrProductNameIsEmpty = errors.New("product name is empty")
 )
 
+// mysqlErrDuplicateEntry is the error number of a unique key violation.
+var mysqlErrDuplicateEntry uint16 = 1062
+
+var (
+	defaultQueryTimeout = 5 * time.Second
+)
+
 type MysqlRepo struct {
-	logger *zap.Logger
-	db     *gorm.DB
+	logger   *zap.Logger
+	db       *gorm.DB
+	timeouts map[string]time.Duration
 }
 
+// NewMySQLRepo creates the repository. Every call is bounded by the timeout
+// configured for its operation in mysql.timeouts, keyed by the snake case
+// name of the method, or by mysql.timeouts.default.
 func NewMySQLRepo(logger *zap.Logger, db *gorm.DB) (*MysqlRepo, error) {
+	if err := registerTracing(db); err != nil {
+		return nil, err
+	}
+
+	timeouts := make(map[string]time.Duration)
+	for operation := range viper.GetStringMap("mysql.timeouts") {
+		timeouts[operation] = viper.GetDuration("mysql.timeouts." + operation)
+	}
+	if timeouts["default"] <= 0 {
+		timeouts["default"] = defaultQueryTimeout
+	}
+
 	return &MysqlRepo{
-		logger: logger,
-		db:     db,
+		logger:   logger,
+		db:       db,
+		timeouts: timeouts,
 	}, nil
 }
 
-func (repo *MysqlRepo) CreateProduct(name string, price uint) (*models.Product, error) {
+// begin bounds ctx by the timeout of the operation. The returned function
+// releases the context and records the latency of the call, it must be
+// deferred.
+func (repo *MysqlRepo) begin(ctx context.Context, method string) (context.Context, func()) {
+	timeout, ok := repo.timeouts[toSnakeCase(method)]
+	if !ok || timeout <= 0 {
+		timeout = repo.timeouts["default"]
+	}
+
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, func() {
+		cancel()
+		metrics.ObserveQuery(method, started)
+	}
+}
+
+// toSnakeCase converts a method name, GetProductByID becomes
+// get_product_by_id.
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	prevLower := false
+	for _, r := range name {
+		if unicode.IsUpper(r) {
+			if prevLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+			prevLower = false
+		} else {
+			prevLower = true
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// log returns the logger of the request or message ctx belongs to.
+func (repo *MysqlRepo) log(ctx context.Context) *zap.Logger {
+	return requestid.Logger(ctx, repo.logger)
+}
+
+// Close closes the connection pool, once every component using the
+// repository has stopped.
+func (repo *MysqlRepo) Close() error {
+	sqlDB, err := repo.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Check pings the database.
+func (repo *MysqlRepo) Check(ctx context.Context) error {
+	sqlDB, err := repo.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (repo *MysqlRepo) CreateProduct(ctx context.Context, name, category string, price, weight uint) (*models.Product, error) {
+	ctx, done := repo.begin(ctx, "CreateProduct")
+	defer done()
+
 	if name == "" {
 		return nil, ErrProductNameIsEmpty
 	}
 
 	product := &models.Product{
 		Name:      name,
+		Category:  category,
 		Price:     price,
+		Weight:    weight,
 		CreatedAt: time.Now().UnixMilli(),
 	}
 
-	if err := repo.db.Create(product).Error; err != nil {
-		repo.logger.Error("Insert new product to database failed", zap.Error(err))
+	if err := repo.db.WithContext(ctx).Create(product).Error; err != nil {
+		repo.log(ctx).Error("Insert new product to database failed", zap.Error(err))
 		return nil, err
 	}
 
 	return product, nil
 }
 
-func (repo *MysqlRepo) GetProductByID(id uint) (*models.Product, error) {
+func (repo *MysqlRepo) GetProductByID(ctx context.Context, id uint) (*models.Product, error) {
+	ctx, done := repo.begin(ctx, "GetProductByID")
+	defer done()
+
 	product := &models.Product{ID: id}
 
-	if err := repo.db.First(product).Error; err != nil {
-		repo.logger.Error("Get product from database failed", zap.Error(err))
+	if err := repo.db.WithContext(ctx).First(product).Error; err != nil {
+		repo.log(ctx).Error("Get product from database failed", zap.Error(err))
 		return nil, err
 	}
 
 	return product, nil
 }
 
-func (repo *MysqlRepo) GetProductByName(name string, limit uint) ([]*models.Product, error) {
+func (repo *MysqlRepo) GetProductByName(ctx context.Context, name string, limit uint) ([]*models.Product, error) {
+	ctx, done := repo.begin(ctx, "GetProductByName")
+	defer done()
+
 	query := `
 		SELECT *, MATCH (name) AGAINST (?) as score FROM products
 		WHERE MATCH (name) AGAINST (?)
@@ -63,54 +173,1124 @@ func (repo *MysqlRepo) GetProductByName(name string, limit uint) ([]*models.Prod
 		LIMIT ?;
 	`
 	var products []*models.Product
-	if err := repo.db.Raw(query, name, name, limit).Scan(&products).Error; err != nil {
-		repo.logger.Error("Get product by name from database failed", zap.Error(err))
+	if err := repo.db.WithContext(ctx).Raw(query, name, name, limit).Scan(&products).Error; err != nil {
+		repo.log(ctx).Error("Get product by name from database failed", zap.Error(err))
 		return nil, err
 	}
 
 	return products, nil
 }
 
-func (repo *MysqlRepo) CreateCustomerActivity(userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error) {
+// UpdateProduct replaces the name, category, price and weight of the product.
+// Lowering its price writes a PRICE_DROPPED event to the outbox in the same
+// transaction, so the drop is published whenever the price is. It returns the
+// updated product and the outbox message of the drop, nil when the price was
+// not lowered.
+func (repo *MysqlRepo) UpdateProduct(ctx context.Context, product *models.Product) (*models.Product, *models.OutboxMessage, error) {
+	ctx, done := repo.begin(ctx, "UpdateProduct")
+	defer done()
+
+	if product.Name == "" {
+		return nil, nil, ErrProductNameIsEmpty
+	}
+
+	updated := &models.Product{}
+	var message *models.OutboxMessage
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(updated, product.ID).Error; err != nil {
+			return err
+		}
+
+		previousPrice := updated.Price
+		product.CreatedAt = updated.CreatedAt
+		*updated = *product
+		err := tx.Model(updated).
+			Select("name", "category", "price", "weight").
+			Updates(updated).Error
+		if err != nil || updated.Price >= previousPrice {
+			return err
+		}
+
+		drop := &models.PriceDrop{
+			ProductID: updated.ID,
+			Name:      updated.Name,
+			OldPrice:  previousPrice,
+			NewPrice:  updated.Price,
+		}
+		payload, err := json.Marshal(drop.Activity(time.Now().UnixMilli()))
+		if err != nil {
+			return err
+		}
+		// keyed by product, so the drops of a product are consumed in order
+		message, err = createOutboxMessage(ctx, tx, viper.GetString("kafka.topic"), "product-"+strconv.FormatUint(uint64(updated.ID), 10), string(payload), tracing.Inject(ctx))
+		return err
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Update product failed", zap.Error(err), zap.Uint("id", product.ID))
+		}
+		return nil, nil, err
+	}
+
+	return updated, message, nil
+}
+
+func (repo *MysqlRepo) CreateCustomerActivity(ctx context.Context, eventID string, userID uint, createdAt int64, action, data string) (*models.CustomerActivity, error) {
+	ctx, done := repo.begin(ctx, "CreateCustomerActivity")
+	defer done()
+
 	customerActivity := &models.CustomerActivity{
+		EventID:   eventID,
 		UserID:    userID,
 		CreatedAt: createdAt,
 		Action:    action,
 		Data:      data,
 	}
 
-	if err := repo.db.Create(customerActivity).Error; err != nil {
-		repo.logger.Error("Insert new customer activity to database failed", zap.Error(err))
+	// activities are delivered at least once, a redelivered activity has the
+	// same event id and is ignored. The event id is the only unique key next
+	// to the generated primary key, no other conflict can be ignored.
+	if err := repo.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(customerActivity).Error; err != nil {
+		repo.log(ctx).Error("Insert new customer activity to database failed", zap.Error(err))
 		return nil, err
 	}
 
 	return customerActivity, nil
 }
 
-func (repo *MysqlRepo) GetCustomerActivities(id uint, limit uint) ([]*models.CustomerActivity, error) {
+// CreateVisitorActivity stores the activity of an anonymous visitor. The
+// activity goes to the timeline of the customer when the visitor has already
+// logged in, which happens for activities still in flight at login.
+func (repo *MysqlRepo) CreateVisitorActivity(ctx context.Context, eventID, visitorID string, createdAt int64, action, data string) error {
+	ctx, done := repo.begin(ctx, "CreateVisitorActivity")
+	defer done()
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		visitor := &models.Visitor{}
+		err := tx.Where("id = ? AND customer_id <> 0", visitorID).Take(visitor).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// activities are delivered at least once, a redelivered activity has
+		// the same event id and is ignored
+		if err == nil {
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.CustomerActivity{
+				EventID:   eventID,
+				UserID:    visitor.CustomerID,
+				CreatedAt: createdAt,
+				Action:    action,
+				Data:      data,
+			}).Error
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.VisitorActivity{
+			EventID:   eventID,
+			VisitorID: visitorID,
+			CreatedAt: createdAt,
+			Action:    action,
+			Data:      data,
+		}).Error
+	})
+	if err != nil {
+		repo.log(ctx).Error("Insert new visitor activity to database failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// IdentifyVisitor links the visitor to the customer and moves the activities
+// of the visitor to the timeline of the customer, in one transaction. It can be
+// repeated safely.
+func (repo *MysqlRepo) IdentifyVisitor(ctx context.Context, visitorID string, customerID uint) error {
+	ctx, done := repo.begin(ctx, "IdentifyVisitor")
+	defer done()
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		visitor := &models.Visitor{
+			ID:           visitorID,
+			CustomerID:   customerID,
+			IdentifiedAt: time.Now().UnixMilli(),
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(visitor).Error; err != nil {
+			return err
+		}
+
+		visitorActivities := []*models.VisitorActivity{}
+		if err := tx.Where("visitor_id = ?", visitorID).Find(&visitorActivities).Error; err != nil {
+			return err
+		}
+		if len(visitorActivities) == 0 {
+			return nil
+		}
+
+		customerActivities := make([]*models.CustomerActivity, 0, len(visitorActivities))
+		for _, activity := range visitorActivities {
+			customerActivities = append(customerActivities, &models.CustomerActivity{
+				EventID:   activity.EventID,
+				UserID:    customerID,
+				CreatedAt: activity.CreatedAt,
+				Action:    activity.Action,
+				Data:      activity.Data,
+			})
+		}
+		// an activity is already in the timeline when its event was
+		// redelivered after the login, it has the same event id
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(customerActivities).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("visitor_id = ?", visitorID).Delete(&models.VisitorActivity{}).Error
+	})
+	if err != nil {
+		repo.log(ctx).Error("Identify visitor failed", zap.Error(err), zap.Uint("customer_id", customerID))
+		return err
+	}
+
+	return nil
+}
+
+func (repo *MysqlRepo) GetCustomerActivities(ctx context.Context, id uint, limit uint) ([]*models.CustomerActivity, error) {
+	ctx, done := repo.begin(ctx, "GetCustomerActivities")
+	defer done()
+
 	var customerActivities []*models.CustomerActivity
 
-	if err := repo.db.Where("user_id = ?", id).
-		Order("created_at DESC").
+	if err := repo.db.WithContext(ctx).Where("user_id = ?", id).
+		Order("created_at DESC, id DESC").
 		Limit(int(limit)).
 		Find(&customerActivities).Error; err != nil {
-		repo.logger.Error("Get customer activities failed", zap.Error(err))
+		repo.log(ctx).Error("Get customer activities failed", zap.Error(err))
 		return nil, err
 	}
 
 	return customerActivities, nil
 }
 
-func (repo *MysqlRepo) GetCustomerActivitiesByAction(id uint, action string, limit uint) ([]*models.CustomerActivity, error) {
+func (repo *MysqlRepo) GetCustomerActivitiesByAction(ctx context.Context, id uint, action string, limit uint) ([]*models.CustomerActivity, error) {
+	ctx, done := repo.begin(ctx, "GetCustomerActivitiesByAction")
+	defer done()
+
 	var customerActivities []*models.CustomerActivity
 
-	if err := repo.db.Where("user_id = ? AND action = ?", id, action).
-		Order("created_at DESC").
+	if err := repo.db.WithContext(ctx).Where("user_id = ? AND action = ?", id, action).
+		Order("created_at DESC, id DESC").
 		Limit(int(limit)).
 		Find(&customerActivities).Error; err != nil {
-		repo.logger.Error("Get customer activities by action failed", zap.Error(err))
+		repo.log(ctx).Error("Get customer activities by action failed", zap.Error(err))
 		return nil, err
 	}
 
 	return customerActivities, nil
 }
+
+func (repo *MysqlRepo) CreateOutboxMessage(ctx context.Context, topic, key, payload string, headers map[string]string) (*models.OutboxMessage, error) {
+	ctx, done := repo.begin(ctx, "CreateOutboxMessage")
+	defer done()
+
+	message, err := createOutboxMessage(ctx, repo.db, topic, key, payload, headers)
+	if err != nil {
+		repo.log(ctx).Error("Insert new outbox message to database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// createOutboxMessage writes a pending message to the outbox with db, the
+// transaction of the change the message is about when there is one.
+func createOutboxMessage(ctx context.Context, db *gorm.DB, topic, key, payload string, headers map[string]string) (*models.OutboxMessage, error) {
+	now := time.Now().UnixMilli()
+	message := &models.OutboxMessage{
+		Topic:         topic,
+		Key:           key,
+		Payload:       payload,
+		Headers:       headers,
+		Status:        models.OutboxStatus_Pending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+
+	if err := db.WithContext(ctx).Create(message).Error; err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetPendingOutboxMessages returns the pending messages due for an attempt, in
+// insertion order. A message is held back while an earlier message with the
+// same key waits for its next attempt, so messages of a key are not published
+// out of order. A message parked as failed no longer holds back its key.
+func (repo *MysqlRepo) GetPendingOutboxMessages(ctx context.Context, limit uint) ([]*models.OutboxMessage, error) {
+	ctx, done := repo.begin(ctx, "GetPendingOutboxMessages")
+	defer done()
+
+	var messages []*models.OutboxMessage
+
+	now := time.Now().UnixMilli()
+	backingOff := repo.db.Table("outbox_messages AS earlier").Select("1").
+		Where("earlier.status = ? AND earlier.`key` = outbox_messages.`key` AND earlier.id < outbox_messages.id AND earlier.next_attempt_at > ?", models.OutboxStatus_Pending, now)
+	if err := repo.db.WithContext(ctx).Where("status = ? AND next_attempt_at <= ? AND NOT EXISTS (?)", models.OutboxStatus_Pending, now, backingOff).
+		Order("id ASC").
+		Limit(int(limit)).
+		Find(&messages).Error; err != nil {
+		repo.log(ctx).Error("Get pending outbox messages failed", zap.Error(err))
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (repo *MysqlRepo) MarkOutboxMessageSent(ctx context.Context, id uint64) error {
+	ctx, done := repo.begin(ctx, "MarkOutboxMessageSent")
+	defer done()
+
+	if err := repo.db.WithContext(ctx).Model(&models.OutboxMessage{ID: id}).Updates(map[string]interface{}{
+		"status":  models.OutboxStatus_Sent,
+		"sent_at": time.Now().UnixMilli(),
+	}).Error; err != nil {
+		repo.log(ctx).Error("Mark outbox message as sent failed", zap.Error(err), zap.Uint64("id", id))
+		return err
+	}
+
+	return nil
+}
+
+// MarkOutboxMessageFailed records a failed delivery attempt. The message is
+// retried at nextAttemptAt unless it has reached maxAttempts, in which case it
+// is parked as failed and no longer picked up by the relay.
+func (repo *MysqlRepo) MarkOutboxMessageFailed(ctx context.Context, id uint64, reason string, nextAttemptAt int64, maxAttempts uint) error {
+	ctx, done := repo.begin(ctx, "MarkOutboxMessageFailed")
+	defer done()
+
+	// MySQL evaluates single-table assignments from left to right, so the
+	// status check below already sees the incremented attempts.
+	if err := repo.db.WithContext(ctx).Model(&models.OutboxMessage{ID: id}).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"last_error":      reason,
+		"next_attempt_at": nextAttemptAt,
+		"status":          gorm.Expr("IF(attempts >= ?, ?, status)", maxAttempts, models.OutboxStatus_Failed),
+	}).Error; err != nil {
+		repo.log(ctx).Error("Mark outbox message as failed failed", zap.Error(err), zap.Uint64("id", id))
+		return err
+	}
+
+	return nil
+}
+
+func (repo *MysqlRepo) CreateCustomer(ctx context.Context, email, name, passwordHash string) (*models.Customer, error) {
+	ctx, done := repo.begin(ctx, "CreateCustomer")
+	defer done()
+
+	customer := &models.Customer{
+		Email:        email,
+		Name:         name,
+		PasswordHash: passwordHash,
+		Role:         models.Role_Customer,
+		CreatedAt:    time.Now().UnixMilli(),
+	}
+
+	if err := repo.db.WithContext(ctx).Create(customer).Error; err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+			return nil, models.ErrCustomerExists
+		}
+		repo.log(ctx).Error("Insert new customer to database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+func (repo *MysqlRepo) GetCustomerByEmail(ctx context.Context, email string) (*models.Customer, error) {
+	ctx, done := repo.begin(ctx, "GetCustomerByEmail")
+	defer done()
+
+	customer := &models.Customer{}
+	if err := repo.db.WithContext(ctx).Where("email = ?", email).First(customer).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Get customer by email failed", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+func (repo *MysqlRepo) GetCustomerRole(ctx context.Context, id uint) (string, error) {
+	ctx, done := repo.begin(ctx, "GetCustomerRole")
+	defer done()
+
+	customer := &models.Customer{}
+	if err := repo.db.WithContext(ctx).Select("role").Where("id = ?", id).First(customer).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Get customer role failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return "", err
+	}
+
+	return customer.Role, nil
+}
+
+// SetCustomerRole replaces the role of the customer, gorm.ErrRecordNotFound is
+// returned when no customer has the email.
+func (repo *MysqlRepo) SetCustomerRole(ctx context.Context, email, role string) error {
+	ctx, done := repo.begin(ctx, "SetCustomerRole")
+	defer done()
+
+	result := repo.db.WithContext(ctx).Model(&models.Customer{}).Where("email = ?", email).Update("role", role)
+	if result.Error != nil {
+		repo.log(ctx).Error("Set customer role failed", zap.Error(result.Error), zap.String("email", email))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// the role may already be set, tell both cases apart
+		var count int64
+		if err := repo.db.WithContext(ctx).Model(&models.Customer{}).Where("email = ?", email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+	}
+
+	return nil
+}
+
+func (repo *MysqlRepo) CreateAPIKey(ctx context.Context, name, prefix, hash string, scopes []string, createdBy uint) (*models.APIKey, error) {
+	ctx, done := repo.begin(ctx, "CreateAPIKey")
+	defer done()
+
+	key := &models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+
+	if err := repo.db.WithContext(ctx).Create(key).Error; err != nil {
+		repo.log(ctx).Error("Insert new api key to database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (repo *MysqlRepo) GetAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	ctx, done := repo.begin(ctx, "GetAPIKeys")
+	defer done()
+
+	var keys []*models.APIKey
+	if err := repo.db.WithContext(ctx).Order("id ASC").Find(&keys).Error; err != nil {
+		repo.log(ctx).Error("Get api keys failed", zap.Error(err))
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (repo *MysqlRepo) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, done := repo.begin(ctx, "GetAPIKeyByHash")
+	defer done()
+
+	key := &models.APIKey{}
+	if err := repo.db.WithContext(ctx).Where("hash = ?", hash).First(key).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Get api key by hash failed", zap.Error(err))
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey revokes an active key, gorm.ErrRecordNotFound is returned when
+// no active key has the id.
+func (repo *MysqlRepo) RevokeAPIKey(ctx context.Context, id uint) error {
+	ctx, done := repo.begin(ctx, "RevokeAPIKey")
+	defer done()
+
+	return revokeAPIKey(ctx, repo.db, id)
+}
+
+// RotateAPIKey revokes the key and creates its replacement with the same name
+// and scopes, in one transaction.
+func (repo *MysqlRepo) RotateAPIKey(ctx context.Context, id uint, prefix, hash string, createdBy uint) (*models.APIKey, error) {
+	ctx, done := repo.begin(ctx, "RotateAPIKey")
+	defer done()
+
+	var rotated *models.APIKey
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old := &models.APIKey{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(old, id).Error; err != nil {
+			return err
+		}
+		if err := revokeAPIKey(ctx, tx, id); err != nil {
+			return err
+		}
+
+		rotated = &models.APIKey{
+			Name:      old.Name,
+			Prefix:    prefix,
+			Hash:      hash,
+			Scopes:    old.Scopes,
+			CreatedBy: createdBy,
+			CreatedAt: time.Now().UnixMilli(),
+		}
+		return tx.Create(rotated).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Rotate api key failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return nil, err
+	}
+
+	return rotated, nil
+}
+
+func revokeAPIKey(ctx context.Context, db *gorm.DB, id uint) error {
+	result := db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at = 0", id).
+		Update("revoked_at", time.Now().UnixMilli())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetCartLines returns the items of the cart of the customer, or of the
+// visitor when customerID is 0, with the current name and price of their
+// product.
+func (repo *MysqlRepo) GetCartLines(ctx context.Context, customerID uint, visitorID string) ([]*models.CartLine, error) {
+	ctx, done := repo.begin(ctx, "GetCartLines")
+	defer done()
+
+	lines := []*models.CartLine{}
+	err := repo.db.WithContext(ctx).Model(&models.CartItem{}).
+		Select("cart_items.product_id, products.name, products.category, products.price, products.weight, cart_items.quantity").
+		Joins("JOIN products ON products.id = cart_items.product_id").
+		Where("cart_items.customer_id = ? AND cart_items.visitor_id = ?", customerID, visitorID).
+		Order("cart_items.id").
+		Scan(&lines).Error
+	if err != nil {
+		repo.log(ctx).Error("Get cart lines from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// AddCartItem adds quantity of the product to the cart, on top of the
+// quantity already in the cart.
+func (repo *MysqlRepo) AddCartItem(ctx context.Context, customerID uint, visitorID string, productID, quantity uint) error {
+	ctx, done := repo.begin(ctx, "AddCartItem")
+	defer done()
+
+	if err := addCartItem(ctx, repo.db, customerID, visitorID, productID, quantity); err != nil {
+		repo.log(ctx).Error("Add cart item failed", zap.Error(err), zap.Uint("product_id", productID))
+		return err
+	}
+
+	return nil
+}
+
+// SetCartItemQuantity changes the quantity of a product already in the cart
+// and returns the quantity it had before.
+func (repo *MysqlRepo) SetCartItemQuantity(ctx context.Context, customerID uint, visitorID string, productID, quantity uint) (uint, error) {
+	ctx, done := repo.begin(ctx, "SetCartItemQuantity")
+	defer done()
+
+	var previous uint
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		item := &models.CartItem{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("customer_id = ? AND visitor_id = ? AND product_id = ?", customerID, visitorID, productID).
+			Take(item).Error
+		if err != nil {
+			return err
+		}
+
+		previous = item.Quantity
+		return tx.Model(item).Updates(map[string]interface{}{
+			"quantity":   quantity,
+			"updated_at": time.Now().UnixMilli(),
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Set cart item quantity failed", zap.Error(err), zap.Uint("product_id", productID))
+		}
+		return 0, err
+	}
+
+	return previous, nil
+}
+
+// RemoveCartItem removes the product from the cart and returns the quantity
+// which was in the cart.
+func (repo *MysqlRepo) RemoveCartItem(ctx context.Context, customerID uint, visitorID string, productID uint) (uint, error) {
+	ctx, done := repo.begin(ctx, "RemoveCartItem")
+	defer done()
+
+	var removed uint
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		item := &models.CartItem{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("customer_id = ? AND visitor_id = ? AND product_id = ?", customerID, visitorID, productID).
+			Take(item).Error
+		if err != nil {
+			return err
+		}
+
+		removed = item.Quantity
+		return tx.Delete(item).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Remove cart item failed", zap.Error(err), zap.Uint("product_id", productID))
+		}
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// MergeCarts moves the cart of the visitor into the cart of the customer, the
+// quantities of a product in both carts are added up.
+func (repo *MysqlRepo) MergeCarts(ctx context.Context, visitorID string, customerID uint) error {
+	ctx, done := repo.begin(ctx, "MergeCarts")
+	defer done()
+
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		items := []*models.CartItem{}
+		if err := tx.Where("customer_id = 0 AND visitor_id = ?", visitorID).Find(&items).Error; err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			if err := addCartItem(ctx, tx, customerID, "", item.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("customer_id = 0 AND visitor_id = ?", visitorID).Delete(&models.CartItem{}).Error
+	})
+	if err != nil {
+		repo.log(ctx).Error("Merge carts failed", zap.Error(err), zap.Uint("customer_id", customerID))
+		return err
+	}
+
+	return nil
+}
+
+func addCartItem(ctx context.Context, db *gorm.DB, customerID uint, visitorID string, productID, quantity uint) error {
+	now := time.Now().UnixMilli()
+	item := &models.CartItem{
+		CustomerID: customerID,
+		VisitorID:  visitorID,
+		ProductID:  productID,
+		Quantity:   quantity,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", quantity),
+			"updated_at": now,
+		}),
+	}).Create(item).Error
+}
+
+// CreateOrderFromCart checks out the cart of the customer: the items are
+// copied to a pending order with the current name and price of their product,
+// the cart is priced by pricer with the coupon of couponCode and shipped to
+// region, the promotions applied are counted as used and the cart is emptied,
+// in one transaction. It returns models.ErrEmptyCart when there is nothing to
+// check out and the errors of pricer.Price when the coupon cannot be used or
+// the region is not supported.
+func (repo *MysqlRepo) CreateOrderFromCart(ctx context.Context, customerID uint, pricer *pricing.Pricer, couponCode, region string) (*models.Order, error) {
+	ctx, done := repo.begin(ctx, "CreateOrderFromCart")
+	defer done()
+
+	var order *models.Order
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the lock keeps a concurrent checkout from ordering the same cart twice
+		lines := []*models.CartLine{}
+		err := tx.Model(&models.CartItem{}).
+			Select("cart_items.product_id, products.name, products.category, products.price, products.weight, cart_items.quantity").
+			Joins("JOIN products ON products.id = cart_items.product_id").
+			Where("cart_items.customer_id = ? AND cart_items.visitor_id = ''", customerID).
+			Order("cart_items.id").
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scan(&lines).Error
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return models.ErrEmptyCart
+		}
+
+		now := time.Now()
+		candidates, err := getCartPromotions(ctx, tx, couponCode, now)
+		if err != nil {
+			return err
+		}
+		quote, err := pricer.Price(lines, candidates, couponCode, region, now)
+		if err != nil {
+			return err
+		}
+		if err := usePromotions(tx, quote.Discounts); err != nil {
+			return err
+		}
+
+		order = &models.Order{
+			CustomerID: customerID,
+			Status:     models.OrderStatus_Pending,
+			Subtotal:   quote.Subtotal,
+			Discount:   quote.Discount,
+			Region:     quote.Region,
+			Shipping:   quote.Shipping,
+			Tax:        quote.Tax,
+			Total:      quote.Total,
+			CouponCode: models.NormalizeCouponCode(couponCode),
+			CreatedAt:  now.UnixMilli(),
+			UpdatedAt:  now.UnixMilli(),
+		}
+		for _, line := range quote.Items {
+			order.Items = append(order.Items, &models.OrderItem{
+				ProductID: line.ProductID,
+				Name:      line.Name,
+				Price:     line.Price,
+				Quantity:  line.Quantity,
+				Subtotal:  line.Subtotal,
+			})
+		}
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("customer_id = ? AND visitor_id = ''", customerID).Delete(&models.CartItem{}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, models.ErrEmptyCart) && !promotions.IsCouponError(err) && !errors.Is(err, pricing.ErrUnknownRegion) {
+			repo.log(ctx).Error("Create order from cart failed", zap.Error(err), zap.Uint("customer_id", customerID))
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetOrders returns the latest orders of the customer, or of every customer
+// when customerID is 0, optionally only those with status.
+func (repo *MysqlRepo) GetOrders(ctx context.Context, customerID uint, status string, limit uint) ([]*models.Order, error) {
+	ctx, done := repo.begin(ctx, "GetOrders")
+	defer done()
+
+	query := repo.db.WithContext(ctx).Preload("Items")
+	if customerID != 0 {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	orders := []*models.Order{}
+	if err := query.Order("id DESC").Limit(int(limit)).Find(&orders).Error; err != nil {
+		repo.log(ctx).Error("Get orders from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (repo *MysqlRepo) GetOrder(ctx context.Context, id uint) (*models.Order, error) {
+	ctx, done := repo.begin(ctx, "GetOrder")
+	defer done()
+
+	order := &models.Order{}
+	if err := repo.db.WithContext(ctx).Preload("Items").First(order, id).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Get order from database failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// UpdateOrderStatus moves the order to status. The order is locked while the
+// transition is checked, it returns models.ErrInvalidTransition when the
+// order cannot move to status. Cancelling the order gives back the use of its
+// coupon in the same transaction.
+func (repo *MysqlRepo) UpdateOrderStatus(ctx context.Context, id uint, status string) (*models.Order, error) {
+	ctx, done := repo.begin(ctx, "UpdateOrderStatus")
+	defer done()
+
+	order := &models.Order{}
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, id).Error; err != nil {
+			return err
+		}
+		if err := order.Transition(status); err != nil {
+			return err
+		}
+		// a cancelled order gives back the use of its coupon
+		if status == models.OrderStatus_Cancelled && order.CouponCode != "" {
+			if err := releaseCoupon(tx, order.CouponCode); err != nil {
+				return err
+			}
+		}
+
+		order.UpdatedAt = time.Now().UnixMilli()
+		return tx.Model(order).Select("status", "updated_at").Updates(order).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, models.ErrInvalidTransition) {
+			repo.log(ctx).Error("Update order status failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ApplyOrderPayment moves the order to status on behalf of the payment
+// intentID and records the intent, see models.Order.ApplyPayment. The order is
+// locked while the payment is checked.
+func (repo *MysqlRepo) ApplyOrderPayment(ctx context.Context, id uint, intentID, status string) (*models.Order, error) {
+	ctx, done := repo.begin(ctx, "ApplyOrderPayment")
+	defer done()
+
+	order := &models.Order{}
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, id).Error; err != nil {
+			return err
+		}
+		previous := *order
+		if err := order.ApplyPayment(intentID, status); err != nil {
+			return err
+		}
+		if order.Status == previous.Status && order.PaymentIntentID == previous.PaymentIntentID {
+			return nil
+		}
+
+		order.UpdatedAt = time.Now().UnixMilli()
+		return tx.Model(order).Select("status", "payment_intent_id", "updated_at").Updates(order).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, models.ErrInvalidTransition) && !errors.Is(err, models.ErrPaymentMismatch) {
+			repo.log(ctx).Error("Apply order payment failed", zap.Error(err), zap.Uint("id", id), zap.String("payment_intent_id", intentID))
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// getCartPromotions returns the promotions a cart may get at now: those
+// without a code which are valid and have not reached their usage limit, and
+// the coupon of code whatever its state, so promotions.Price tells why it
+// cannot be used.
+func getCartPromotions(ctx context.Context, db *gorm.DB, code string, now time.Time) ([]*models.Promotion, error) {
+	at := now.UnixMilli()
+	query := db.WithContext(ctx).
+		Where("code IS NULL AND (starts_at = 0 OR starts_at <= ?) AND (ends_at = 0 OR ends_at > ?) AND (usage_limit = 0 OR usage_count < usage_limit)", at, at)
+	if code = models.NormalizeCouponCode(code); code != "" {
+		query = query.Or("code = ?", code)
+	}
+
+	candidates := []*models.Promotion{}
+	if err := query.Order("id").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// releaseCoupon gives back the use of the coupon of code counted at checkout.
+func releaseCoupon(tx *gorm.DB, code string) error {
+	return tx.Model(&models.Promotion{}).
+		Where("code = ? AND usage_count > 0", code).
+		Update("usage_count", gorm.Expr("usage_count - 1")).Error
+}
+
+// usePromotions counts an use of the promotions of the discounts. The usage
+// limit is checked again by the update, a promotion used up by a concurrent
+// checkout fails with models.ErrPromotionUsedUp.
+func usePromotions(tx *gorm.DB, discounts []*promotions.Discount) error {
+	for _, discount := range discounts {
+		result := tx.Model(&models.Promotion{}).
+			Where("id = ? AND (usage_limit = 0 OR usage_count < usage_limit)", discount.PromotionID).
+			Update("usage_count", gorm.Expr("usage_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrPromotionUsedUp
+		}
+	}
+	return nil
+}
+
+// GetCartPromotions returns the promotions a cart may get now, see
+// getCartPromotions.
+func (repo *MysqlRepo) GetCartPromotions(ctx context.Context, code string) ([]*models.Promotion, error) {
+	ctx, done := repo.begin(ctx, "GetCartPromotions")
+	defer done()
+
+	candidates, err := getCartPromotions(ctx, repo.db, code, time.Now())
+	if err != nil {
+		repo.log(ctx).Error("Get cart promotions from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// CreatePromotion stores the promotion, it returns models.ErrCouponCodeExists
+// when another promotion has its code.
+func (repo *MysqlRepo) CreatePromotion(ctx context.Context, promotion *models.Promotion) (*models.Promotion, error) {
+	ctx, done := repo.begin(ctx, "CreatePromotion")
+	defer done()
+
+	now := time.Now().UnixMilli()
+	promotion.UsageCount = 0
+	promotion.CreatedAt = now
+	promotion.UpdatedAt = now
+
+	if err := repo.db.WithContext(ctx).Create(promotion).Error; err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+			return nil, models.ErrCouponCodeExists
+		}
+		repo.log(ctx).Error("Insert new promotion to database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+func (repo *MysqlRepo) GetPromotions(ctx context.Context) ([]*models.Promotion, error) {
+	ctx, done := repo.begin(ctx, "GetPromotions")
+	defer done()
+
+	promotions := []*models.Promotion{}
+	if err := repo.db.WithContext(ctx).Order("id DESC").Find(&promotions).Error; err != nil {
+		repo.log(ctx).Error("Get promotions from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return promotions, nil
+}
+
+func (repo *MysqlRepo) GetPromotion(ctx context.Context, id uint) (*models.Promotion, error) {
+	ctx, done := repo.begin(ctx, "GetPromotion")
+	defer done()
+
+	promotion := &models.Promotion{}
+	if err := repo.db.WithContext(ctx).First(promotion, id).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Get promotion from database failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+// UpdatePromotion replaces the rule of the promotion, its usage count is kept.
+func (repo *MysqlRepo) UpdatePromotion(ctx context.Context, promotion *models.Promotion) (*models.Promotion, error) {
+	ctx, done := repo.begin(ctx, "UpdatePromotion")
+	defer done()
+
+	updated := &models.Promotion{}
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(updated, promotion.ID).Error; err != nil {
+			return err
+		}
+
+		promotion.UsageCount = updated.UsageCount
+		promotion.CreatedAt = updated.CreatedAt
+		promotion.UpdatedAt = time.Now().UnixMilli()
+		*updated = *promotion
+		return tx.Model(updated).
+			Select("name", "code", "type", "value", "buy_quantity", "get_quantity", "category", "min_subtotal", "usage_limit", "starts_at", "ends_at", "updated_at").
+			Updates(updated).Error
+	})
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+			return nil, models.ErrCouponCodeExists
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Update promotion failed", zap.Error(err), zap.Uint("id", promotion.ID))
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (repo *MysqlRepo) DeletePromotion(ctx context.Context, id uint) error {
+	ctx, done := repo.begin(ctx, "DeletePromotion")
+	defer done()
+
+	result := repo.db.WithContext(ctx).Delete(&models.Promotion{}, id)
+	if result.Error != nil {
+		repo.log(ctx).Error("Delete promotion failed", zap.Error(result.Error), zap.Uint("id", id))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetWishlist returns the products in the wishlist of the customer with their
+// current name and price, the latest saved first.
+func (repo *MysqlRepo) GetWishlist(ctx context.Context, customerID uint) ([]*models.WishlistLine, error) {
+	ctx, done := repo.begin(ctx, "GetWishlist")
+	defer done()
+
+	lines := []*models.WishlistLine{}
+	err := repo.db.WithContext(ctx).Model(&models.WishlistItem{}).
+		Select("wishlist_items.product_id, products.name, products.price, wishlist_items.created_at").
+		Joins("JOIN products ON products.id = wishlist_items.product_id").
+		Where("wishlist_items.customer_id = ?", customerID).
+		Order("wishlist_items.id DESC").
+		Scan(&lines).Error
+	if err != nil {
+		repo.log(ctx).Error("Get wishlist from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// AddWishlistItem saves the product in the wishlist of the customer, saving it
+// again changes nothing.
+func (repo *MysqlRepo) AddWishlistItem(ctx context.Context, customerID, productID uint) error {
+	ctx, done := repo.begin(ctx, "AddWishlistItem")
+	defer done()
+
+	item := &models.WishlistItem{
+		CustomerID: customerID,
+		ProductID:  productID,
+		CreatedAt:  time.Now().UnixMilli(),
+	}
+	if err := repo.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(item).Error; err != nil {
+		repo.log(ctx).Error("Add wishlist item failed", zap.Error(err), zap.Uint("product_id", productID))
+		return err
+	}
+
+	return nil
+}
+
+// RemoveWishlistItem removes the product from the wishlist of the customer,
+// it returns gorm.ErrRecordNotFound when it is not in the wishlist.
+func (repo *MysqlRepo) RemoveWishlistItem(ctx context.Context, customerID, productID uint) error {
+	ctx, done := repo.begin(ctx, "RemoveWishlistItem")
+	defer done()
+
+	result := repo.db.WithContext(ctx).
+		Where("customer_id = ? AND product_id = ?", customerID, productID).
+		Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		repo.log(ctx).Error("Remove wishlist item failed", zap.Error(result.Error), zap.Uint("product_id", productID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// NotifyPriceDrop notifies the customers having the product of the drop in
+// their wishlist. It can be repeated safely, the customers already notified of
+// the drop made at droppedAt are not notified again. It returns how many
+// notifications were created.
+func (repo *MysqlRepo) NotifyPriceDrop(ctx context.Context, drop *models.PriceDrop, droppedAt int64) (int64, error) {
+	ctx, done := repo.begin(ctx, "NotifyPriceDrop")
+	defer done()
+
+	var (
+		notified int64
+		items    []*models.WishlistItem
+	)
+	err := repo.db.WithContext(ctx).
+		Where("product_id = ?", drop.ProductID).
+		FindInBatches(&items, 100, func(tx *gorm.DB, batch int) error {
+			notifications := make([]*models.Notification, 0, len(items))
+			for _, item := range items {
+				notifications = append(notifications, drop.Notification(item.CustomerID, droppedAt))
+			}
+
+			result := repo.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(notifications)
+			notified += result.RowsAffected
+			return result.Error
+		}).Error
+	if err != nil {
+		repo.log(ctx).Error("Notify price drop failed", zap.Error(err), zap.Uint("product_id", drop.ProductID))
+		return notified, err
+	}
+
+	return notified, nil
+}
+
+// GetNotifications returns the latest notifications of the customer, only the
+// unread ones when unread is true.
+func (repo *MysqlRepo) GetNotifications(ctx context.Context, customerID uint, unread bool, limit uint) ([]*models.Notification, error) {
+	ctx, done := repo.begin(ctx, "GetNotifications")
+	defer done()
+
+	query := repo.db.WithContext(ctx).Where("customer_id = ?", customerID)
+	if unread {
+		query = query.Where("read_at = 0")
+	}
+
+	notifications := []*models.Notification{}
+	if err := query.Order("created_at DESC, id DESC").Limit(int(limit)).Find(&notifications).Error; err != nil {
+		repo.log(ctx).Error("Get notifications from database failed", zap.Error(err))
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// ReadNotification marks the notification of the customer as read, reading it
+// again keeps the time it was first read. The notifications of other
+// customers are gorm.ErrRecordNotFound.
+func (repo *MysqlRepo) ReadNotification(ctx context.Context, customerID, id uint) (*models.Notification, error) {
+	ctx, done := repo.begin(ctx, "ReadNotification")
+	defer done()
+
+	notification := &models.Notification{}
+	err := repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND customer_id = ?", id, customerID).
+			Take(notification).Error
+		if err != nil || notification.ReadAt != 0 {
+			return err
+		}
+
+		notification.ReadAt = time.Now().UnixMilli()
+		return tx.Model(notification).Update("read_at", notification.ReadAt).Error
+	})
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			repo.log(ctx).Error("Read notification failed", zap.Error(err), zap.Uint("id", id))
+		}
+		return nil, err
+	}
+
+	return notification, nil
+}
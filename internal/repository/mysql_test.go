@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ldmtam/ecommerce-demo/internal/models"
+	"github.com/ldmtam/ecommerce-demo/internal/pricing"
 	"github.com/ldmtam/ecommerce-demo/internal/repository"
 	"github.com/ldmtam/ecommerce-demo/utils"
 	"github.com/ory/dockertest/v3"
@@ -20,6 +22,8 @@ import (
 var (
 	db   *gorm.DB
 	repo *repository.MysqlRepo
+	// noCharges prices orders without shipping nor tax
+	noCharges = pricing.NewPricer(pricing.NoTax{}, &pricing.FlatRate{})
 )
 
 func TestMain(m *testing.M) {
@@ -49,7 +53,7 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Could not connect to database: %s", err)
 	}
 
-	db.AutoMigrate(models.Product{}, models.CustomerActivity{})
+	db.AutoMigrate(models.Product{}, models.CustomerActivity{}, models.OutboxMessage{}, models.Customer{}, models.APIKey{}, models.Visitor{}, models.VisitorActivity{}, models.CartItem{}, models.Order{}, models.OrderItem{}, models.Promotion{}, models.WishlistItem{}, models.Notification{})
 	logger := utils.NewLogger("./logs")
 
 	repo, err = repository.NewMySQLRepo(logger, db)
@@ -99,7 +103,7 @@ func TestCreateProduct(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			out, err := repo.CreateProduct(test.input.name, test.input.price)
+			out, err := repo.CreateProduct(context.Background(), test.input.name, "", test.input.price, 0)
 			if out != nil {
 				assert.EqualValues(t, test.expectedOutput, out.ID)
 			}
@@ -134,10 +138,10 @@ func TestGetProductByID(t *testing.T) {
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			out, err := repo.CreateProduct(test.input.name, test.input.price)
+			out, err := repo.CreateProduct(context.Background(), test.input.name, "", test.input.price, 0)
 			assert.Nil(t, err)
 
-			createdProduct, err := repo.GetProductByID(out.ID)
+			createdProduct, err := repo.GetProductByID(context.Background(), out.ID)
 			assert.EqualValues(t, test.expectedError, err)
 			assert.EqualValues(t, test.expectedOutput.ID, createdProduct.ID)
 			assert.EqualValues(t, test.expectedOutput.Name, createdProduct.Name)
@@ -145,3 +149,342 @@ func TestGetProductByID(t *testing.T) {
 		})
 	}
 }
+
+func TestOutboxMessageLifecycle(t *testing.T) {
+	created, err := repo.CreateOutboxMessage(context.Background(), "product-activities", "1", `{"UserID":1}`, map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	assert.Nil(t, err)
+	assert.EqualValues(t, models.OutboxStatus_Pending, created.Status)
+
+	pending, err := repo.GetPendingOutboxMessages(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.EqualValues(t, created.ID, pending[0].ID)
+	assert.Equal(t, created.Headers, pending[0].Headers)
+
+	// a failed attempt postpones the message until its next attempt time
+	err = repo.MarkOutboxMessageFailed(context.Background(), created.ID, "broker unavailable", time.Now().Add(time.Hour).UnixMilli(), 3)
+	assert.Nil(t, err)
+	pending, err = repo.GetPendingOutboxMessages(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 0)
+
+	// reaching the maximum attempts parks the message as failed
+	err = repo.MarkOutboxMessageFailed(context.Background(), created.ID, "broker unavailable", 0, 2)
+	assert.Nil(t, err)
+	failed := &models.OutboxMessage{ID: created.ID}
+	assert.Nil(t, db.First(failed).Error)
+	assert.EqualValues(t, models.OutboxStatus_Failed, failed.Status)
+	assert.EqualValues(t, 2, failed.Attempts)
+
+	sent, err := repo.CreateOutboxMessage(context.Background(), "product-activities", "2", `{"UserID":2}`, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.MarkOutboxMessageSent(context.Background(), sent.ID))
+	pending, err = repo.GetPendingOutboxMessages(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 0)
+}
+
+func TestPendingOutboxMessagesKeepPerKeyOrder(t *testing.T) {
+	first, err := repo.CreateOutboxMessage(context.Background(), "product-activities", "3", `{"UserID":3}`, nil)
+	assert.Nil(t, err)
+	second, err := repo.CreateOutboxMessage(context.Background(), "product-activities", "3", `{"UserID":3}`, nil)
+	assert.Nil(t, err)
+	other, err := repo.CreateOutboxMessage(context.Background(), "product-activities", "4", `{"UserID":4}`, nil)
+	assert.Nil(t, err)
+
+	// the key waits for the first message to back off, other keys do not
+	assert.Nil(t, repo.MarkOutboxMessageFailed(context.Background(), first.ID, "broker unavailable", time.Now().Add(time.Hour).UnixMilli(), 3))
+	pending, err := repo.GetPendingOutboxMessages(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.EqualValues(t, other.ID, pending[0].ID)
+
+	// once the first message is due again the key is relayed in order
+	assert.Nil(t, repo.MarkOutboxMessageFailed(context.Background(), first.ID, "broker unavailable", 0, 3))
+	pending, err = repo.GetPendingOutboxMessages(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 3)
+	assert.EqualValues(t, first.ID, pending[0].ID)
+	assert.EqualValues(t, second.ID, pending[1].ID)
+
+	for _, message := range pending {
+		assert.Nil(t, repo.MarkOutboxMessageSent(context.Background(), message.ID))
+	}
+}
+
+func TestIdentifyVisitor(t *testing.T) {
+	visitorID := "0123456789abcdef0123456789abcdef"
+	assert.Nil(t, repo.CreateVisitorActivity(context.Background(), "visitor-event-1", visitorID, 1, models.CustomAction_ViewProduct, `{"ID":1}`))
+	assert.Nil(t, repo.CreateVisitorActivity(context.Background(), "visitor-event-2", visitorID, 2, models.CustomAction_SearchProduct, `[]`))
+
+	// the history of the visitor moves to the customer on login
+	assert.Nil(t, repo.IdentifyVisitor(context.Background(), visitorID, 42))
+	activities, err := repo.GetCustomerActivities(context.Background(), 42, 10)
+	assert.Nil(t, err)
+	assert.Len(t, activities, 2)
+
+	// activities arriving after the login go to the customer directly
+	assert.Nil(t, repo.CreateVisitorActivity(context.Background(), "visitor-event-3", visitorID, 3, models.CustomAction_ViewProduct, `{"ID":2}`))
+	activities, err = repo.GetCustomerActivities(context.Background(), 42, 10)
+	assert.Nil(t, err)
+	assert.Len(t, activities, 3)
+
+	// identifying again or redelivering an activity is harmless
+	assert.Nil(t, repo.IdentifyVisitor(context.Background(), visitorID, 42))
+	assert.Nil(t, repo.CreateVisitorActivity(context.Background(), "visitor-event-1", visitorID, 1, models.CustomAction_ViewProduct, `{"ID":1}`))
+	activities, err = repo.GetCustomerActivities(context.Background(), 42, 10)
+	assert.Nil(t, err)
+	assert.Len(t, activities, 3)
+}
+
+func TestCreateCustomerActivityDeduplicatesEvents(t *testing.T) {
+	_, err := repo.CreateCustomerActivity(context.Background(), "event-1", 43, 1, models.CustomAction_ViewProduct, `{"ID":1}`)
+	assert.Nil(t, err)
+	// another activity at the same time is kept
+	_, err = repo.CreateCustomerActivity(context.Background(), "event-2", 43, 1, models.CustomAction_AddToCart, `{"ID":1}`)
+	assert.Nil(t, err)
+	// a redelivered event is stored once
+	_, err = repo.CreateCustomerActivity(context.Background(), "event-1", 43, 1, models.CustomAction_ViewProduct, `{"ID":1}`)
+	assert.Nil(t, err)
+
+	activities, err := repo.GetCustomerActivities(context.Background(), 43, 10)
+	assert.Nil(t, err)
+	assert.Len(t, activities, 2)
+}
+
+func TestCartLifecycle(t *testing.T) {
+	shoes, err := repo.CreateProduct(context.Background(), "Cart shoes", "", 100, 0)
+	assert.Nil(t, err)
+	socks, err := repo.CreateProduct(context.Background(), "Cart socks", "", 10, 0)
+	assert.Nil(t, err)
+
+	visitorID := "fedcba9876543210fedcba9876543210"
+	assert.Nil(t, repo.AddCartItem(context.Background(), 0, visitorID, shoes.ID, 1))
+	assert.Nil(t, repo.AddCartItem(context.Background(), 0, visitorID, shoes.ID, 2))
+	assert.Nil(t, repo.AddCartItem(context.Background(), 0, visitorID, socks.ID, 4))
+
+	lines, err := repo.GetCartLines(context.Background(), 0, visitorID)
+	assert.Nil(t, err)
+	assert.Len(t, lines, 2)
+	assert.EqualValues(t, 3, lines[0].Quantity)
+	assert.EqualValues(t, 100, lines[0].Price)
+
+	previous, err := repo.SetCartItemQuantity(context.Background(), 0, visitorID, socks.ID, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 4, previous)
+
+	_, err = repo.RemoveCartItem(context.Background(), 0, visitorID, 999999)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// the cart of the visitor is added to the cart of the customer on login
+	assert.Nil(t, repo.AddCartItem(context.Background(), 43, "", shoes.ID, 1))
+	assert.Nil(t, repo.MergeCarts(context.Background(), visitorID, 43))
+	lines, err = repo.GetCartLines(context.Background(), 43, "")
+	assert.Nil(t, err)
+	assert.Len(t, lines, 2)
+	assert.EqualValues(t, 4, lines[0].Quantity)
+
+	lines, err = repo.GetCartLines(context.Background(), 0, visitorID)
+	assert.Nil(t, err)
+	assert.Len(t, lines, 0)
+
+	removed, err := repo.RemoveCartItem(context.Background(), 43, "", socks.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, removed)
+}
+
+func TestCheckout(t *testing.T) {
+	product, err := repo.CreateProduct(context.Background(), "Order shoes", "", 120, 0)
+	assert.Nil(t, err)
+
+	_, err = repo.CreateOrderFromCart(context.Background(), 44, noCharges, "", "")
+	assert.ErrorIs(t, err, models.ErrEmptyCart)
+
+	assert.Nil(t, repo.AddCartItem(context.Background(), 44, "", product.ID, 2))
+	order, err := repo.CreateOrderFromCart(context.Background(), 44, noCharges, "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderStatus_Pending, order.Status)
+	assert.EqualValues(t, 240, order.Total)
+
+	// the order keeps the price the product had at checkout
+	assert.Nil(t, db.Model(product).Update("price", 150).Error)
+	created, err := repo.GetOrder(context.Background(), order.ID)
+	assert.Nil(t, err)
+	assert.Len(t, created.Items, 1)
+	assert.EqualValues(t, 120, created.Items[0].Price)
+	assert.Equal(t, "Order shoes", created.Items[0].Name)
+
+	lines, err := repo.GetCartLines(context.Background(), 44, "")
+	assert.Nil(t, err)
+	assert.Len(t, lines, 0)
+
+	_, err = repo.UpdateOrderStatus(context.Background(), order.ID, models.OrderStatus_Shipped)
+	assert.ErrorIs(t, err, models.ErrInvalidTransition)
+	paid, err := repo.UpdateOrderStatus(context.Background(), order.ID, models.OrderStatus_Paid)
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderStatus_Paid, paid.Status)
+
+	orders, err := repo.GetOrders(context.Background(), 44, models.OrderStatus_Paid, 10)
+	assert.Nil(t, err)
+	assert.Len(t, orders, 1)
+}
+
+func TestApplyOrderPayment(t *testing.T) {
+	product, err := repo.CreateProduct(context.Background(), "Paid shoes", "", 90, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, repo.AddCartItem(context.Background(), 45, "", product.ID, 1))
+	order, err := repo.CreateOrderFromCart(context.Background(), 45, noCharges, "", "")
+	assert.Nil(t, err)
+
+	// applying the payment twice, like a retried request and its webhook do
+	for i := 0; i < 2; i++ {
+		paid, err := repo.ApplyOrderPayment(context.Background(), order.ID, "pi_45", models.OrderStatus_Paid)
+		assert.Nil(t, err)
+		assert.Equal(t, models.OrderStatus_Paid, paid.Status)
+		assert.Equal(t, "pi_45", paid.PaymentIntentID)
+	}
+
+	_, err = repo.ApplyOrderPayment(context.Background(), order.ID, "pi_other", models.OrderStatus_Refunded)
+	assert.ErrorIs(t, err, models.ErrPaymentMismatch)
+
+	refunded, err := repo.ApplyOrderPayment(context.Background(), order.ID, "pi_45", models.OrderStatus_Refunded)
+	assert.Nil(t, err)
+	assert.Equal(t, models.OrderStatus_Refunded, refunded.Status)
+}
+
+func TestCheckoutWithCoupon(t *testing.T) {
+	shoes, err := repo.CreateProduct(context.Background(), "Coupon shoes", "shoes", 100, 0)
+	assert.Nil(t, err)
+
+	code := "ONCE10"
+	coupon, err := repo.CreatePromotion(context.Background(), &models.Promotion{
+		Name:       "Once",
+		Code:       &code,
+		Type:       models.PromotionType_FixedAmount,
+		Value:      10,
+		Category:   "shoes",
+		UsageLimit: 1,
+	})
+	assert.Nil(t, err)
+
+	_, err = repo.CreatePromotion(context.Background(), &models.Promotion{Name: "Twice", Code: &code, Type: models.PromotionType_FixedAmount, Value: 10})
+	assert.ErrorIs(t, err, models.ErrCouponCodeExists)
+
+	assert.Nil(t, repo.AddCartItem(context.Background(), 46, "", shoes.ID, 1))
+	order, err := repo.CreateOrderFromCart(context.Background(), 46, noCharges, "once10", "")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 100, order.Subtotal)
+	assert.EqualValues(t, 10, order.Discount)
+	assert.EqualValues(t, 90, order.Total)
+	assert.Equal(t, "ONCE10", order.CouponCode)
+
+	used, err := repo.GetPromotion(context.Background(), coupon.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, used.UsageCount)
+
+	// the coupon is used up, the cart is kept
+	assert.Nil(t, repo.AddCartItem(context.Background(), 46, "", shoes.ID, 1))
+	_, err = repo.CreateOrderFromCart(context.Background(), 46, noCharges, "ONCE10", "")
+	assert.ErrorIs(t, err, models.ErrPromotionUsedUp)
+	lines, err := repo.GetCartLines(context.Background(), 46, "")
+	assert.Nil(t, err)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "shoes", lines[0].Category)
+
+	// cancelling the order gives the coupon back
+	_, err = repo.UpdateOrderStatus(context.Background(), order.ID, models.OrderStatus_Cancelled)
+	assert.Nil(t, err)
+	released, err := repo.GetPromotion(context.Background(), coupon.ID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, released.UsageCount)
+	_, err = repo.CreateOrderFromCart(context.Background(), 46, noCharges, "ONCE10", "")
+	assert.Nil(t, err)
+
+	assert.Nil(t, repo.DeletePromotion(context.Background(), coupon.ID))
+	assert.ErrorIs(t, repo.DeletePromotion(context.Background(), coupon.ID), gorm.ErrRecordNotFound)
+}
+
+func TestCheckoutWithShippingAndTax(t *testing.T) {
+	boots, err := repo.CreateProduct(context.Background(), "Heavy boots", "shoes", 200, 1500)
+	assert.Nil(t, err)
+	rates, err := pricing.NewRateTable(map[string]uint{"US": 0, "US-CA": 725})
+	assert.Nil(t, err)
+	pricer := pricing.NewPricer(rates, &pricing.WeightRate{Base: 5, PerKg: 2})
+
+	assert.Nil(t, repo.AddCartItem(context.Background(), 47, "", boots.ID, 2))
+	lines, err := repo.GetCartLines(context.Background(), 47, "")
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1500, lines[0].Weight)
+
+	_, err = repo.CreateOrderFromCart(context.Background(), 47, pricer, "", "FR")
+	assert.ErrorIs(t, err, pricing.ErrUnknownRegion)
+
+	order, err := repo.CreateOrderFromCart(context.Background(), 47, pricer, "", "us-ca")
+	assert.Nil(t, err)
+	assert.Equal(t, "US-CA", order.Region)
+	assert.EqualValues(t, 400, order.Subtotal)
+	assert.EqualValues(t, 11, order.Shipping)
+	assert.EqualValues(t, 29, order.Tax)
+	assert.EqualValues(t, 440, order.Total)
+}
+
+func TestWishlistPriceDrops(t *testing.T) {
+	product, err := repo.CreateProduct(context.Background(), "Wished shoes", "shoes", 250, 0)
+	assert.Nil(t, err)
+
+	for _, customerID := range []uint{48, 49} {
+		assert.Nil(t, repo.AddWishlistItem(context.Background(), customerID, product.ID))
+	}
+	// saving it again changes nothing
+	assert.Nil(t, repo.AddWishlistItem(context.Background(), 48, product.ID))
+	wishlist, err := repo.GetWishlist(context.Background(), 48)
+	assert.Nil(t, err)
+	assert.Len(t, wishlist, 1)
+	assert.Equal(t, "Wished shoes", wishlist[0].Name)
+
+	product.Price = 300
+	updated, priceDrop, err := repo.UpdateProduct(context.Background(), product)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 300, updated.Price)
+	assert.Nil(t, priceDrop)
+
+	// the drop is written to the outbox with the price
+	product.Price = 200
+	updated, priceDrop, err = repo.UpdateProduct(context.Background(), product)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 200, updated.Price)
+	assert.Equal(t, fmt.Sprintf("product-%d", product.ID), priceDrop.Key)
+	activity := &models.CustomerActivity{}
+	assert.Nil(t, json.Unmarshal([]byte(priceDrop.Payload), activity))
+	assert.Equal(t, models.CustomAction_PriceDropped, activity.Action)
+	assert.JSONEq(t, fmt.Sprintf(`{"productId":%d,"name":"Wished shoes","oldPrice":300,"newPrice":200}`, product.ID), activity.Data)
+
+	_, _, err = repo.UpdateProduct(context.Background(), &models.Product{ID: 1 << 30, Name: "Nothing"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	drop := &models.PriceDrop{ProductID: product.ID, Name: product.Name, OldPrice: 300, NewPrice: 200}
+	notified, err := repo.NotifyPriceDrop(context.Background(), drop, 1000)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, notified)
+	// a redelivered drop notifies nobody again
+	notified, err = repo.NotifyPriceDrop(context.Background(), drop, 1000)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, notified)
+
+	notifications, err := repo.GetNotifications(context.Background(), 48, true, 10)
+	assert.Nil(t, err)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, "Wished shoes in your wishlist dropped from 300 to 200", notifications[0].Message)
+
+	_, err = repo.ReadNotification(context.Background(), 49, notifications[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	read, err := repo.ReadNotification(context.Background(), 48, notifications[0].ID)
+	assert.Nil(t, err)
+	assert.NotZero(t, read.ReadAt)
+	notifications, err = repo.GetNotifications(context.Background(), 48, true, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, notifications)
+
+	assert.Nil(t, repo.RemoveWishlistItem(context.Background(), 48, product.ID))
+	assert.ErrorIs(t, repo.RemoveWishlistItem(context.Background(), 48, product.ID), gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,102 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	Header = "X-Request-ID"
+	// LogKey is the field holding the request id in log lines.
+	LogKey = "request_id"
+)
+
+var maxLength = 128
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id carried by ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns logger with the request id of ctx attached, so log lines of
+// the same request, or of the events it published, can be correlated.
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := FromContext(ctx); id != "" {
+		return logger.With(zap.String(LogKey, id))
+	}
+	return logger
+}
+
+// Middleware accepts the request id sent by the caller, or generates one, and
+// puts it in the request context and the response headers.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !isValid(id) {
+			id = generate()
+		}
+
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// LogFields adds the request id to the access log lines of ginzap.
+func LogFields(c *gin.Context) []zapcore.Field {
+	return []zapcore.Field{zap.String(LogKey, FromContext(c.Request.Context()))}
+}
+
+// Propagator carries the request id in the headers of a message, next to the
+// trace context.
+type Propagator struct{}
+
+func (Propagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if id := FromContext(ctx); id != "" {
+		carrier.Set(Header, id)
+	}
+}
+
+func (Propagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	if id := carrier.Get(Header); isValid(id) {
+		return NewContext(ctx, id)
+	}
+	return ctx
+}
+
+func (Propagator) Fields() []string {
+	return []string{Header}
+}
+
+// isValid rejects ids which would pollute the logs, only printable ascii is
+// accepted.
+func isValid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		header   string
+		expected string
+	}{
+		"id is generated when missing": {
+			header: "",
+		},
+		"id of the caller is kept": {
+			header:   "4bf92f3577b34da6",
+			expected: "4bf92f3577b34da6",
+		},
+		"id with spaces is replaced": {
+			header: "not a request id",
+		},
+		"id too long is replaced": {
+			header: strings.Repeat("a", 129),
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var seen string
+			router := gin.New()
+			router.Use(requestid.Middleware())
+			router.GET("/", func(c *gin.Context) {
+				seen = requestid.FromContext(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				req.Header.Set(requestid.Header, test.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.NotEmpty(t, seen)
+			assert.Equal(t, seen, w.Header().Get(requestid.Header))
+			if test.expected != "" {
+				assert.Equal(t, test.expected, seen)
+			} else {
+				assert.NotEqual(t, test.header, seen)
+			}
+		})
+	}
+}
+
+func TestPropagator(t *testing.T) {
+	headers := propagation.MapCarrier{}
+	requestid.Propagator{}.Inject(requestid.NewContext(context.Background(), "4bf92f3577b34da6"), headers)
+
+	ctx := requestid.Propagator{}.Extract(context.Background(), headers)
+	assert.Equal(t, "4bf92f3577b34da6", requestid.FromContext(ctx))
+
+	ctx = requestid.Propagator{}.Extract(context.Background(), propagation.MapCarrier{})
+	assert.Empty(t, requestid.FromContext(ctx))
+}
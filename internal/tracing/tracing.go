@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ldmtam/ecommerce-demo/internal/requestid"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownExporter = errors.New("unknown tracing exporter")
+)
+
+var (
+	Exporter_None = "none"
+	Exporter_OTLP = "otlp"
+	Exporter_File = "file"
+)
+
+var (
+	defaultServiceName = "ecommerce-demo"
+	defaultSampleRatio = 1.0
+)
+
+var instrumentationName = "github.com/ldmtam/ecommerce-demo"
+
+// Shutdown flushes the spans which have not been exported yet.
+type Shutdown func(ctx context.Context) error
+
+// Init installs the global tracer provider configured in the tracing section
+// and the propagator of the W3C trace context and of the request id. No span
+// is exported when tracing.exporter is not set, the trace context is still
+// propagated.
+func Init(logger *zap.Logger) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		requestid.Propagator{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch name := viper.GetString("tracing.exporter"); name {
+	case "", Exporter_None:
+		return func(ctx context.Context) error { return nil }, nil
+	case Exporter_OTLP:
+		exporter, err = newOTLPExporter()
+	case Exporter_File:
+		exporter, err = newFileExporter()
+	default:
+		logger.Error("Tracing exporter is unknown", zap.String("exporter", name))
+		return nil, ErrUnknownExporter
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := viper.GetString("tracing.service_name")
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	sampleRatio := defaultSampleRatio
+	if viper.IsSet("tracing.sample_ratio") {
+		sampleRatio = viper.GetFloat64("tracing.sample_ratio")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.Info("Tracing enabled",
+		zap.String("exporter", viper.GetString("tracing.exporter")),
+		zap.String("service", serviceName),
+		zap.Float64("sample ratio", sampleRatio))
+
+	return provider.Shutdown, nil
+}
+
+func newOTLPExporter() (sdktrace.SpanExporter, error) {
+	options := []otlptracehttp.Option{}
+	if endpoint := viper.GetString("tracing.otlp.endpoint"); endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(endpoint))
+	}
+	if viper.GetBool("tracing.otlp.insecure") {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// newFileExporter writes the spans as json lines, to inspect traces locally
+// without a collector.
+func newFileExporter() (sdktrace.SpanExporter, error) {
+	path := viper.GetString("tracing.file.path")
+	if path == "" {
+		return nil, fmt.Errorf("tracing.file.path is required by the %s exporter", Exporter_File)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return stdouttrace.New(stdouttrace.WithWriter(file))
+}
+
+// Tracer returns the tracer of the application from the global provider, so
+// spans are no-ops until Init installed a provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject returns the trace context and the request id of ctx as headers, to
+// be carried by a message.
+func Inject(ctx context.Context) map[string]string {
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	return headers
+}
+
+// Extract returns ctx carrying the trace context and the request id found in
+// headers.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// GinMiddleware starts a server span per request, continuing the trace of the
+// caller when the request carries a trace context. Handlers get the span from
+// c.Request.Context().
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Request.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(c.Request.URL.Path),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("http status %d", status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetAttributes(attribute.String("gin.errors", c.Errors.String()))
+		}
+	}
+}
@@ -1,29 +1,134 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger(logPath string) *zap.Logger {
+var (
+	ErrUnknownLogEncoding = errors.New("unknown log encoding")
+	ErrUnknownLogOutput   = errors.New("unknown log output")
+)
+
+var (
+	LogEncoding_JSON    = "json"
+	LogEncoding_Console = "console"
+
+	LogOutput_Stdout = "stdout"
+	LogOutput_File   = "file"
+)
+
+// LoggerConfig describes where and how log lines are written. Rotation only
+// applies to the file output.
+type LoggerConfig struct {
+	Level      string
+	Encoding   string
+	Outputs    []string
+	Path       string
+	MaxSize    int // megabytes
+	MaxBackups int
+	MaxAge     int // days
+}
+
+// LoggerConfigFromViper reads the log settings of the setting section,
+// defaulting to info level json lines written to a rotated file.
+func LoggerConfigFromViper() LoggerConfig {
+	config := LoggerConfig{
+		Level:      viper.GetString("setting.log_level"),
+		Encoding:   viper.GetString("setting.log_encoding"),
+		Outputs:    viper.GetStringSlice("setting.log_outputs"),
+		Path:       viper.GetString("setting.log_path"),
+		MaxSize:    viper.GetInt("setting.log_max_size"),
+		MaxBackups: viper.GetInt("setting.log_max_backups"),
+		MaxAge:     viper.GetInt("setting.log_max_age"),
+	}
+	if config.Level == "" {
+		config.Level = "info"
+	}
+	if config.Encoding == "" {
+		config.Encoding = LogEncoding_JSON
+	}
+	if len(config.Outputs) == 0 {
+		config.Outputs = []string{LogOutput_File}
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 10
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 10
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = 30
+	}
+	return config
+}
+
+// NewConfiguredLogger builds a logger from config. The returned level can be
+// changed while the logger is in use, it also serves GET and PUT requests to
+// read and change it over http.
+func NewConfiguredLogger(config LoggerConfig) (*zap.Logger, zap.AtomicLevel, error) {
+	atomicLevel := zap.NewAtomicLevel()
+	if err := atomicLevel.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, atomicLevel, err
+	}
+
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.TimeKey = "ts"
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
-	atomicLevel := zap.NewAtomicLevelAt(zap.InfoLevel)
-	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		zapcore.AddSync(&lumberjack.Logger{
-			Filename:   fmt.Sprintf("%s/%s.log", logPath, "data"),
-			MaxSize:    10, // megabytes
-			MaxBackups: 10,
-			MaxAge:     30, // days
-		}),
-		atomicLevel,
-	)
-	return zap.New(core, zap.AddCaller())
+
+	var encoder zapcore.Encoder
+	switch config.Encoding {
+	case LogEncoding_JSON:
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	case LogEncoding_Console:
+		encoderCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	default:
+		return nil, atomicLevel, fmt.Errorf("%w: %s", ErrUnknownLogEncoding, config.Encoding)
+	}
+
+	var syncers []zapcore.WriteSyncer
+	for _, output := range config.Outputs {
+		switch output {
+		case LogOutput_Stdout:
+			syncers = append(syncers, zapcore.Lock(os.Stdout))
+		case LogOutput_File:
+			syncers = append(syncers, zapcore.AddSync(&lumberjack.Logger{
+				Filename:   fmt.Sprintf("%s/%s.log", config.Path, "data"),
+				MaxSize:    config.MaxSize,
+				MaxBackups: config.MaxBackups,
+				MaxAge:     config.MaxAge,
+			}))
+		default:
+			return nil, atomicLevel, fmt.Errorf("%w: %s", ErrUnknownLogOutput, output)
+		}
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), atomicLevel)
+	return zap.New(core, zap.AddCaller()), atomicLevel, nil
+}
+
+// NewLogger writes info level json lines to a rotated file in logPath.
+func NewLogger(logPath string) *zap.Logger {
+	logger, _, err := NewConfiguredLogger(LoggerConfig{
+		Level:      "info",
+		Encoding:   LogEncoding_JSON,
+		Outputs:    []string{LogOutput_File},
+		Path:       logPath,
+		MaxSize:    10,
+		MaxBackups: 10,
+		MaxAge:     30,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return logger
 }
 
 func NewRawLogger(logPath string) *zap.Logger {
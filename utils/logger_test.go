@@ -0,0 +1,56 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/ldmtam/ecommerce-demo/utils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewConfiguredLogger(t *testing.T) {
+	tests := map[string]struct {
+		config      utils.LoggerConfig
+		expectedErr error
+	}{
+		"console on stdout": {
+			config: utils.LoggerConfig{Level: "debug", Encoding: utils.LogEncoding_Console, Outputs: []string{utils.LogOutput_Stdout}},
+		},
+		"json on stdout and file": {
+			config: utils.LoggerConfig{Level: "info", Encoding: utils.LogEncoding_JSON, Outputs: []string{utils.LogOutput_Stdout, utils.LogOutput_File}, Path: t.TempDir()},
+		},
+		"unknown encoding": {
+			config:      utils.LoggerConfig{Level: "info", Encoding: "xml", Outputs: []string{utils.LogOutput_Stdout}},
+			expectedErr: utils.ErrUnknownLogEncoding,
+		},
+		"unknown output": {
+			config:      utils.LoggerConfig{Level: "info", Encoding: utils.LogEncoding_JSON, Outputs: []string{"syslog"}},
+			expectedErr: utils.ErrUnknownLogOutput,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			logger, _, err := utils.NewConfiguredLogger(test.config)
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.NotNil(t, logger)
+		})
+	}
+}
+
+func TestLogLevelChangesAtRuntime(t *testing.T) {
+	logger, logLevel, err := utils.NewConfiguredLogger(utils.LoggerConfig{
+		Level:    "info",
+		Encoding: utils.LogEncoding_JSON,
+		Outputs:  []string{utils.LogOutput_Stdout},
+	})
+	assert.Nil(t, err)
+	assert.False(t, logger.Core().Enabled(zap.DebugLevel))
+
+	logLevel.SetLevel(zap.DebugLevel)
+	assert.True(t, logger.Core().Enabled(zap.DebugLevel))
+}